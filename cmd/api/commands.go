@@ -0,0 +1,153 @@
+package main
+
+import (
+	"backend/migrations"
+	"backend/models"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//runCommand runs one of the maintenance commands instead of the server.
+//Usage: api [flags] purge
+//       api [flags] import [-dry-run] [-format csv|ndjson] file
+//       api [flags] migrate
+//       api [flags] user [-admin] [-password password] email
+func (app *application) runCommand(ctx context.Context, name string, args []string) error {
+	switch name {
+	case "migrate":
+		return app.migrate(ctx)
+	case "purge":
+		return app.purgeTrash(ctx)
+	case "import":
+		return app.importCommand(ctx, args)
+	case "user":
+		return app.userCommand(ctx, os.Stdin, args)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+//migrate brings the database schema up to the newest migration
+func (app *application) migrate(ctx context.Context) error {
+	n, err := models.Migrate(ctx, app.db, app.dialect, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Printf("ran %d migrations", n)
+	return nil
+}
+
+//purgeTrash removes every movie that has been in the trash longer than the retention period
+func (app *application) purgeTrash(ctx context.Context) error {
+	before := time.Now().Add(-app.config.trash.retention)
+
+	n, err := app.models.Movies.PurgeMovies(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Printf("purged %d movies deleted before %s", n, before.Format(time.RFC3339))
+	return nil
+}
+
+//importCommand is the bulk import from the command line.It prints the same report the http endpoint sends
+func (app *application) importCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Check the file without saving anything")
+	format := fs.String("format", "", "csv or ndjson, guessed from the file extension when empty")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: import [-dry-run] [-format csv|ndjson] file")
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = "csv"
+		case ".ndjson", ".jsonl":
+			*format = "ndjson"
+		default:
+			return errors.New("can't tell the format from the file name, use -format")
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	report, err := app.importMovies(ctx, f, *format, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(report)
+	if err != nil {
+		return err
+	}
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d rows failed, nothing was saved", report.Failed)
+	}
+	return nil
+}
+
+//userCommand adds a user that can sign in, or gives an existing one a new password.There are no accounts after the migrations,
+//so this is how the first one is made.Without -password the password is read from the first line of stdin,
+//which keeps it out of the shell history and the process list
+func (app *application) userCommand(ctx context.Context, stdin io.Reader, args []string) error {
+	fs := flag.NewFlagSet("user", flag.ContinueOnError)
+	admin := fs.Bool("admin", false, "Let the user moderate reviews")
+	password := fs.String("password", "", "The password, read from stdin when empty")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || strings.TrimSpace(fs.Arg(0)) == "" {
+		return errors.New("usage: user [-admin] [-password password] email")
+	}
+
+	if *password == "" {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	if *password == "" {
+		return errors.New("the password can't be empty")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user := models.User{Email: strings.TrimSpace(fs.Arg(0)), Password: string(hash), Admin: *admin}
+	err = app.models.Users.SaveUser(ctx, &user)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Printf("saved user %d %s", user.ID, user.Email)
+	return nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+//compressor is what the gzip, brotli and zstd writers have in common
+type compressor interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(w io.Writer)
+}
+
+//contentEncodings we can compress with, in the order we like them best when the client likes them the same.
+//The writers are pooled, they are expensive to set up for every response
+var contentEncodings = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{"br", &sync.Pool{New: func() interface{} {
+		//4 is about as fast as gzip and still smaller
+		return brotli.NewWriterLevel(nil, 4)
+	}}},
+	{"zstd", &sync.Pool{New: func() interface{} {
+		//one goroutine per response is plenty for responses this size
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+		return enc
+	}}},
+	{"gzip", &sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}},
+}
+
+//compressibleTypes are the content types worth compressing.Images, xlsx and the like are compressed already
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/xml":        true,
+	"application/msgpack":    true,
+	"application/x-ndjson":   true,
+	"application/javascript": true,
+	"image/svg+xml":          true,
+}
+
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return compressibleTypes[mediaType] || strings.HasPrefix(mediaType, "text/")
+}
+
+//negotiateEncoding picks the content encoding for an Accept-Encoding header, following the q values.
+//It returns -1 when the client takes none of ours, or didn't send the header at all
+func negotiateEncoding(acceptEncoding string) int {
+	q := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		value := 1.0
+		if k, v, ok := strings.Cut(params, "="); ok && strings.TrimSpace(k) == "q" {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				continue
+			}
+			value = f
+		}
+		q[name] = value
+	}
+
+	best, bestQ := -1, 0.0
+	for i, enc := range contentEncodings {
+		//* stands for everything the client didn't list
+		value, ok := q[enc.name]
+		if !ok {
+			value = q["*"]
+		}
+		//q=0 means "not this one", and for the same q the one we like better wins
+		if value > bestQ {
+			best, bestQ = i, value
+		}
+	}
+	return best
+}
+
+//compressWriter holds on to the start of a response until it knows whether to compress it.Short responses
+//aren't worth it, so nothing is compressed until minSize bytes came in or the handler flushes
+type compressWriter struct {
+	http.ResponseWriter
+	//index into contentEncodings, -1 when the client takes none
+	encoding int
+	minSize  int
+	status   int
+	buf      []byte
+	//set once the headers went out.It is the compressor or the ResponseWriter itself
+	out io.Writer
+	enc compressor
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	cw.WriteHeader(http.StatusOK)
+	if cw.out != nil {
+		return cw.out.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.minSize || !cw.compressible() {
+		err := cw.start(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+//Flush sends what we have so far, compressed if the response is.A handler flushing is streaming, so the
+//response gets compressed even if it's still short
+func (cw *compressWriter) Flush() {
+	if cw.out == nil {
+		cw.WriteHeader(http.StatusOK)
+		if cw.start(true) != nil {
+			return
+		}
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//compressible checks the headers the handler set.A response without a Content-Type yet may still be one
+func (cw *compressWriter) compressible() bool {
+	h := cw.Header()
+	switch cw.status {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	if cw.status < 200 || h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	return contentType == "" || compressibleType(contentType)
+}
+
+//start sends the headers and what was buffered.The response is compressed when compress is true, the client takes
+//one of our encodings and the content is worth compressing
+func (cw *compressWriter) start(compress bool) error {
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		//what net/http would do anyway, we need to know the type now
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	cw.out = cw.ResponseWriter
+	if cw.compressible() {
+		//a cache has to keep the compressed and the plain response apart, even when this one is plain.
+		//Add keeps what checkToken and writeResponse put in Vary already
+		if !varies(h, "Accept-Encoding") {
+			h.Add("Vary", "Accept-Encoding")
+		}
+
+		if compress && cw.encoding >= 0 {
+			encoding := contentEncodings[cw.encoding]
+			cw.enc = encoding.pool.Get().(compressor)
+			cw.enc.Reset(cw.ResponseWriter)
+			cw.out = cw.enc
+
+			h.Set("Content-Encoding", encoding.name)
+			h.Del("Content-Length")
+			//ranges count the plain bytes
+			h.Del("Accept-Ranges")
+			//the compressed bytes aren't the ones conditionalGET hashed, the ETag is only weakly the same
+			if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+				h.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.out.Write(buf)
+	return err
+}
+
+//close sends a response that stayed under minSize as it is, and finishes a compressed one
+func (cw *compressWriter) close() {
+	if cw.out == nil {
+		if cw.status == 0 {
+			//the handler sent nothing at all, leave it to net/http
+			return
+		}
+		cw.start(false)
+	}
+	if cw.enc == nil {
+		return
+	}
+
+	cw.enc.Close()
+	cw.release()
+}
+
+//release puts the compressor back in its pool.Without close before it the compressed stream stays cut off
+func (cw *compressWriter) release() {
+	if cw.enc == nil {
+		return
+	}
+	cw.enc.Reset(nil)
+	contentEncodings[cw.encoding].pool.Put(cw.enc)
+	cw.enc = nil
+}
+
+//compresses tells conditionalGET whether a 200 with this body would go out compressed.A 304 has no body to look at,
+//but it has to have the ETag and Vary the 200 would have had
+func (cw *compressWriter) compresses(contentType string, body []byte) bool {
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	if cw.Header().Get("Content-Encoding") != "" || !compressibleType(contentType) {
+		return false
+	}
+	if !varies(cw.Header(), "Accept-Encoding") {
+		cw.Header().Add("Vary", "Accept-Encoding")
+	}
+	return cw.encoding >= 0 && len(body) >= cw.minSize
+}
+
+//varies reports whether the Vary header already lists name
+func varies(h http.Header, name string) bool {
+	for _, value := range h.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//compress compresses responses with gzip, brotli or zstd, whichever the client prefers in Accept-Encoding.
+//Only text like content of at least -compress-min-size bytes is compressed, see compressibleTypes
+func (app *application) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//HEAD has no body to compress
+		if app.config.compress.minSize < 0 || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding")),
+			minSize:        app.config.compress.minSize,
+		}
+		//when a handler panics, like the export does to abort, the client mustn't get an ending that makes the
+		//cut off body look complete.The compressor is only given back, the stream isn't finished
+		defer func() {
+			if p := recover(); p != nil {
+				cw.release()
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(cw, r)
+		cw.close()
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//the openapi document is written by hand.openapi_test.go fails when a route in routes() is missing from it.
+//Swagger UI is embedded too so the docs work offline, see docs/swagger-ui/README.md
+//
+//go:generate sh -c "curl -sSfL https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-5.17.14.tgz | tar -xz -C docs/swagger-ui --strip-components=1 package/swagger-ui.css package/swagger-ui-bundle.js package/LICENSE"
+//go:embed docs/openapi.json docs/swagger.html docs/swagger-ui
+var docs embed.FS
+
+//serves the openapi document as it is, without the usual envelope
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveDoc(w, r, "docs/openapi.json", "application/json")
+}
+
+//serves swagger ui pointed at /v1/openapi.json
+func (app *application) swaggerHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveDoc(w, r, "docs/swagger.html", "text/html; charset=utf-8")
+}
+
+//serves the css and js of swagger ui, the page asks for them relative to /v1/docs
+func (app *application) swaggerFileHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("file")
+	app.serveDoc(w, r, "docs/swagger-ui/"+name, mime.TypeByExtension(path.Ext(name)))
+}
+
+func (app *application) serveDoc(w http.ResponseWriter, r *http.Request, name, contentType string) {
+	b, err := docs.ReadFile(name)
+	//names with .. in them are invalid for embed.FS and not found as well
+	if errors.Is(err, fs.ErrNotExist) {
+		app.errorResponse(w, r, errors.New("not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"archive/zip"
+	"backend/models"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+//exportColumns are the columns of CSV and XLSX exports, the same ones an import takes
+var exportColumns = []string{"id", "title", "description", "release_date", "runtime", "rating", "mpaa_rating", "genres"}
+
+//exportFormats maps each export format to its content type and file extension
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	"csv":    {"text/csv; charset=utf-8", ".csv"},
+	"ndjson": {"application/x-ndjson", ".ndjson"},
+	"xlsx":   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"},
+}
+
+//movieExporter writes movies one at a time in some file format
+type movieExporter interface {
+	WriteMovie(rec movieRecord) error
+	//Close writes whatever the format needs at the end.It doesn't close the underlying writer
+	Close() error
+}
+
+//newMovieRecord turns a movie from the database into a row of the export
+func newMovieRecord(movie *models.Movie, genres []string) movieRecord {
+	return movieRecord{
+		ID:          movie.ID,
+		Title:       movie.Title,
+		Description: movie.Description,
+		ReleaseDate: movie.ReleaseDate.Format("2006-01-02"),
+		Runtime:     movie.Runtime,
+		Rating:      movie.Rating,
+		MPAARating:  movie.MPAARating,
+		Genres:      genres,
+	}
+}
+
+//fields returns the record in the order of exportColumns
+func (rec movieRecord) fields() []string {
+	return []string{
+		strconv.Itoa(rec.ID),
+		rec.Title,
+		rec.Description,
+		rec.ReleaseDate,
+		strconv.Itoa(rec.Runtime),
+		strconv.Itoa(rec.Rating),
+		rec.MPAARating,
+		joinGenres(rec.Genres),
+	}
+}
+
+func newMovieExporter(w io.Writer, format string) (movieExporter, error) {
+	switch format {
+	case "csv":
+		return newCSVExporter(w)
+	case "ndjson":
+		return &ndjsonExporter{enc: json.NewEncoder(w)}, nil
+	case "xlsx":
+		return newXLSXExporter(w)
+	default:
+		return nil, fmt.Errorf("unknown export format %q, use csv, ndjson or xlsx", format)
+	}
+}
+
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func newCSVExporter(w io.Writer) (*csvExporter, error) {
+	cw := csv.NewWriter(w)
+	err := cw.Write(exportColumns)
+	if err != nil {
+		return nil, err
+	}
+	return &csvExporter{w: cw}, nil
+}
+
+func (e *csvExporter) WriteMovie(rec movieRecord) error {
+	return e.w.Write(rec.fields())
+}
+
+func (e *csvExporter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExporter) WriteMovie(rec movieRecord) error {
+	//Encode puts a newline after every object which is exactly ndjson
+	return e.enc.Encode(rec)
+}
+
+func (e *ndjsonExporter) Close() error {
+	return nil
+}
+
+//xlsxExporter writes a spreadsheet with a single sheet.An xlsx file is a zip of xml files, the sheet is written
+//row by row into the zip so nothing is kept in memory.Everything else in the file is fixed
+type xlsxExporter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	row   int
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="Movies" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
+
+func newXLSXExporter(w io.Writer) (*xlsxExporter, error) {
+	zw := zip.NewWriter(w)
+
+	fixed := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, f := range fixed {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.WriteString(fw, f.body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//the sheet has to be the last file because we keep writing into it
+	sw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	e := &xlsxExporter{zw: zw, sheet: bufio.NewWriter(sw)}
+	e.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]interface{}, len(exportColumns))
+	for i, c := range exportColumns {
+		header[i] = c
+	}
+	return e, e.writeRow(header)
+}
+
+//writeRow writes one row.Strings go in as inline strings so we don't need a shared strings table
+func (e *xlsxExporter) writeRow(cells []interface{}) error {
+	e.row++
+	fmt.Fprintf(e.sheet, `<row r="%d">`, e.row)
+
+	for _, cell := range cells {
+		switch v := cell.(type) {
+		case int:
+			fmt.Fprintf(e.sheet, `<c><v>%d</v></c>`, v)
+		default:
+			e.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			err := xml.EscapeText(e.sheet, []byte(fmt.Sprint(v)))
+			if err != nil {
+				return err
+			}
+			e.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+
+	_, err := e.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (e *xlsxExporter) WriteMovie(rec movieRecord) error {
+	return e.writeRow([]interface{}{
+		rec.ID,
+		rec.Title,
+		rec.Description,
+		rec.ReleaseDate,
+		rec.Runtime,
+		rec.Rating,
+		rec.MPAARating,
+		joinGenres(rec.Genres),
+	})
+}
+
+func (e *xlsxExporter) Close() error {
+	e.sheet.WriteString(`</sheetData></worksheet>`)
+	err := e.sheet.Flush()
+	if err != nil {
+		return err
+	}
+	return e.zw.Close()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"backend/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//streams the whole catalogue as csv, ndjson or xlsx.It takes the same genre_id filter as the movie listing
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	info, ok := exportFormats[format]
+	if !ok {
+		app.errorResponse(w, r, fmt.Errorf("unknown export format %q, use csv, ndjson or xlsx", format))
+		return
+	}
+
+	var filter models.MovieFilter
+	if v := r.URL.Query().Get("genre_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			app.errorResponse(w, r, errors.New("genre_id must be a positive number"))
+			return
+		}
+		filter.GenreID = id
+	}
+
+	filename := fmt.Sprintf("movies-%s%s", time.Now().Format("20060102"), info.extension)
+	w.Header().Set("Content-Type", info.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	//the catalogue can take longer to send than -write-timeout, the deadline moves as long as the client keeps reading.
+	//EachMovie still stops after 10 minutes
+	exporter, err := newMovieExporter(app.keepWriting(w, r), format)
+	if err == nil {
+		err = app.models.Movies.EachMovie(r.Context(), filter, func(movie *models.Movie, genres []string) error {
+			return exporter.WriteMovie(newMovieRecord(movie, genres))
+		})
+	}
+	if err == nil {
+		err = exporter.Close()
+	}
+
+	//part of the file may be sent already so we can't answer with a json error anymore.
+	//Aborting drops the connection so the client sees a failed download instead of a cut off file
+	if err != nil {
+		app.logger.Println("export failed:", err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"backend/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+//graphqlSchema is everything the /graphql endpoint can answer.Mutations and "me" need a signed in user
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	movie(id: Int!): Movie
+	movies(genreId: Int, title: String, sort: String, first: Int = 20, offset: Int = 0): MoviePage!
+	genres: [Genre!]!
+	me: User
+}
+
+type Mutation {
+	createMovie(input: MovieInput!): Movie!
+	updateMovie(id: Int!, input: MovieInput!): Movie!
+	deleteMovie(id: Int!): Boolean!
+}
+
+type Movie {
+	id: Int!
+	title: String!
+	description: String!
+	year: Int!
+	releaseDate: String
+	runtime: Int!
+	rating: Int!
+	mpaaRating: String!
+	averageRating: Float!
+	ratingCount: Int!
+	genres: [Genre!]!
+}
+
+type MoviePage {
+	items: [Movie!]!
+	total: Int!
+}
+
+type Genre {
+	id: Int!
+	name: String!
+}
+
+type User {
+	id: Int!
+	email: String!
+}
+
+input MovieInput {
+	title: String!
+	description: String
+	releaseDate: String!
+	runtime: Int
+	rating: Int
+	mpaaRating: String
+}
+`
+
+//errUnauthorized is what resolvers return when they need a signed in user and there isn't one
+var errUnauthorized = errors.New("unauthorized")
+
+//graphqlRequest is the usual body of a graphql POST
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	//some clients send extensions like persisted query hashes.We don't use them but they shouldn't be refused
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+//the endpoint is public, so queries are kept small.Our own types nest 4 deep at most, movies { items { genres { name } } },
+//the rest of graphqlMaxDepth is room for the introspection queries tools send
+const (
+	graphqlMaxDepth  = 10
+	graphqlMaxLength = 4096
+)
+
+//newGraphQLSchema parses the schema and checks that the resolvers match it.Both are fixed so this only fails if the code is wrong
+func (app *application) newGraphQLSchema() *graphql.Schema {
+	return graphql.MustParseSchema(graphqlSchema, &queryResolver{app: app}, graphql.MaxDepth(graphqlMaxDepth))
+}
+
+//graphqlHandler answers graphql queries.Sending a token is optional, but a bad one is refused like checkToken does
+func (app *application) graphqlHandler(schema *graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), genreLoaderKey, newGenreLoader(app.models.Genres))
+
+		if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+			userID, status, err := app.validateToken(authHeader)
+			if err != nil {
+				app.errorResponse(w, r, err, status)
+				return
+			}
+			ctx = context.WithValue(ctx, graphqlUserKey, userID)
+		}
+
+		var req graphqlRequest
+		err := app.readJSON(w, r, &req)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+		//the library has no limit on the size of a query, only on its depth
+		if len(req.Query) > graphqlMaxLength {
+			app.errorResponse(w, r, fmt.Errorf("query is longer than %d bytes", graphqlMaxLength))
+			return
+		}
+
+		//graphql errors go in the body next to the data, so the status stays 200
+		resp := schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+//genreLoader batches genre lookups for one request.Whoever lists movies primes it with their ids,
+//then the first Movie.genres asked for fetches the genres of every primed movie in one query.
+//Without it every movie in a list would cost one more query
+type genreLoader struct {
+	genres  models.GenreRepository
+	mu      sync.Mutex
+	pending map[int]bool
+	loaded  map[int][]*models.Genre
+}
+
+func newGenreLoader(genres models.GenreRepository) *genreLoader {
+	return &genreLoader{
+		genres:  genres,
+		pending: make(map[int]bool),
+		loaded:  make(map[int][]*models.Genre),
+	}
+}
+
+//prime remembers movie ids so they are fetched together with the next load
+func (l *genreLoader) prime(movieIDs ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, id := range movieIDs {
+		if _, ok := l.loaded[id]; !ok {
+			l.pending[id] = true
+		}
+	}
+}
+
+//load returns the genres of one movie, fetching everything that is pending in the same query
+func (l *genreLoader) load(ctx context.Context, movieID int) ([]*models.Genre, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if genres, ok := l.loaded[movieID]; ok {
+		return genres, nil
+	}
+
+	l.pending[movieID] = true
+	ids := make([]int, 0, len(l.pending))
+	for id := range l.pending {
+		ids = append(ids, id)
+	}
+
+	byMovie, err := l.genres.GenresForMovies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		//movies without genres are remembered too so we don't ask again
+		l.loaded[id] = byMovie[id]
+		delete(l.pending, id)
+	}
+
+	return l.loaded[movieID], nil
+}
+
+//graphqlContextKey is for our values in the context the resolvers get
+type graphqlContextKey string
+
+const (
+	genreLoaderKey graphqlContextKey = "genreLoader"
+	graphqlUserKey graphqlContextKey = "user"
+)
+
+func loaderFrom(ctx context.Context) *genreLoader {
+	return ctx.Value(genreLoaderKey).(*genreLoader)
+}
+
+//signedInUser returns the user id from the token, or errUnauthorized if the request had none
+func signedInUser(ctx context.Context) (int, error) {
+	id, ok := ctx.Value(graphqlUserKey).(int)
+	if !ok {
+		return 0, errUnauthorized
+	}
+	return id, nil
+}
+
+type queryResolver struct {
+	app *application
+}
+
+func (q *queryResolver) Movie(ctx context.Context, args struct{ ID int32 }) (*movieResolver, error) {
+	movie, err := q.app.models.Movies.Get(ctx, int(args.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &movieResolver{movie: movie}, nil
+}
+
+func (q *queryResolver) Movies(ctx context.Context, args struct {
+	GenreID *int32
+	Title   *string
+	Sort    *string
+	First   int32
+	Offset  int32
+}) (*moviePageResolver, error) {
+	var filter models.MovieFilter
+	if args.GenreID != nil {
+		filter.GenreID = int(*args.GenreID)
+	}
+	if args.Title != nil {
+		filter.Title = *args.Title
+	}
+	if args.Sort != nil {
+		filter.Sort = *args.Sort
+	}
+
+	//the schema fills in first and offset when they are left out
+	first, offset := int(args.First), int(args.Offset)
+	if first < 1 || first > maxPageSize {
+		return nil, errors.New("first must be between 1 and 100")
+	}
+	if offset < 0 {
+		return nil, errors.New("offset can't be negative")
+	}
+
+	movies, total, err := q.app.models.Movies.ListMovies(ctx, filter, first, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	//the genres of the whole page get fetched together
+	page := &moviePageResolver{total: total}
+	loader := loaderFrom(ctx)
+	for _, movie := range movies {
+		loader.prime(movie.ID)
+		page.items = append(page.items, &movieResolver{movie: movie})
+	}
+	return page, nil
+}
+
+func (q *queryResolver) Genres(ctx context.Context) ([]*genreResolver, error) {
+	genres, err := q.app.models.Genres.GenreAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*genreResolver, len(genres))
+	for i, g := range genres {
+		resolvers[i] = &genreResolver{genre: g}
+	}
+	return resolvers, nil
+}
+
+func (q *queryResolver) Me(ctx context.Context) (*userResolver, error) {
+	id, err := signedInUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := q.app.models.Users.GetUser(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &userResolver{user: user}, nil
+}
+
+//movieInput is the MovieInput type of the schema
+type movieInput struct {
+	Title       string
+	Description *string
+	ReleaseDate string
+	Runtime     *int32
+	Rating      *int32
+	MPAARating  *string
+}
+
+//apply checks the input and copies it onto movie.What the input leaves out stays as it is on movie,
+//the result is checked by MoviePayload.validate like the rest api does
+func (in movieInput) apply(movie *models.Movie) error {
+	//a bad date only counts when there is a title, without one validate says the title is required first
+	releaseDate, err := time.Parse("2006-01-02", in.ReleaseDate)
+	if err != nil && strings.TrimSpace(in.Title) != "" {
+		return errors.New("releaseDate must look like 2006-01-02")
+	}
+
+	payload := MoviePayload{
+		Title:       in.Title,
+		Description: movie.Description,
+		ReleaseDate: models.NewDate(releaseDate),
+		Runtime:     FlexInt(movie.Runtime),
+		Rating:      FlexInt(movie.Rating),
+		MPAARating:  movie.MPAARating,
+	}
+	if in.Description != nil {
+		payload.Description = *in.Description
+	}
+	if in.Runtime != nil {
+		payload.Runtime = FlexInt(*in.Runtime)
+	}
+	if in.Rating != nil {
+		payload.Rating = FlexInt(*in.Rating)
+	}
+	if in.MPAARating != nil {
+		payload.MPAARating = *in.MPAARating
+	}
+
+	err = payload.validate()
+	if err != nil {
+		return err
+	}
+
+	movie.Title = strings.TrimSpace(payload.Title)
+	movie.Description = payload.Description
+	movie.ReleaseDate = payload.ReleaseDate
+	movie.Year = releaseDate.Year()
+	movie.Runtime = int(payload.Runtime)
+	movie.Rating = int(payload.Rating)
+	movie.MPAARating = payload.MPAARating
+	movie.Updated_At = time.Now()
+	return nil
+}
+
+func (q *queryResolver) CreateMovie(ctx context.Context, args struct{ Input movieInput }) (*movieResolver, error) {
+	if _, err := signedInUser(ctx); err != nil {
+		return nil, err
+	}
+
+	var movie models.Movie
+	err := args.Input.apply(&movie)
+	if err != nil {
+		return nil, err
+	}
+	movie.Created_At = time.Now()
+
+	err = q.app.models.Movies.InsertMovie(ctx, &movie)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := q.app.models.Movies.Get(ctx, movie.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &movieResolver{movie: created}, nil
+}
+
+func (q *queryResolver) UpdateMovie(ctx context.Context, args struct {
+	ID    int32
+	Input movieInput
+}) (*movieResolver, error) {
+	if _, err := signedInUser(ctx); err != nil {
+		return nil, err
+	}
+
+	err := q.app.models.WithTx(ctx, func(tx models.Models) error {
+		movie, err := tx.Movies.Get(ctx, int(args.ID))
+		if err != nil {
+			return err
+		}
+
+		err = args.Input.apply(movie)
+		if err != nil {
+			return err
+		}
+		return tx.Movies.UpdateMovie(ctx, movie)
+	})
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, models.ErrNotFound) {
+		return nil, errors.New("movie not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := q.app.models.Movies.Get(ctx, int(args.ID))
+	if err != nil {
+		return nil, err
+	}
+	return &movieResolver{movie: updated}, nil
+}
+
+func (q *queryResolver) DeleteMovie(ctx context.Context, args struct{ ID int32 }) (bool, error) {
+	if _, err := signedInUser(ctx); err != nil {
+		return false, err
+	}
+
+	err := q.app.models.Movies.DeleteMovieDb(ctx, int(args.ID))
+	if errors.Is(err, models.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type moviePageResolver struct {
+	items []*movieResolver
+	total int
+}
+
+func (p *moviePageResolver) Items() []*movieResolver {
+	if p.items == nil {
+		return []*movieResolver{}
+	}
+	return p.items
+}
+
+func (p *moviePageResolver) Total() int32 {
+	return int32(p.total)
+}
+
+type movieResolver struct {
+	movie *models.Movie
+}
+
+func (r *movieResolver) ID() int32              { return int32(r.movie.ID) }
+func (r *movieResolver) Title() string          { return r.movie.Title }
+func (r *movieResolver) Description() string    { return r.movie.Description }
+func (r *movieResolver) Year() int32            { return int32(r.movie.Year) }
+func (r *movieResolver) Runtime() int32         { return int32(r.movie.Runtime) }
+func (r *movieResolver) Rating() int32          { return int32(r.movie.Rating) }
+func (r *movieResolver) MPAARating() string     { return r.movie.MPAARating }
+func (r *movieResolver) AverageRating() float64 { return r.movie.AverageRating }
+func (r *movieResolver) RatingCount() int32     { return int32(r.movie.RatingCount) }
+
+//ReleaseDate is null for a movie without one, instead of the zero date
+func (r *movieResolver) ReleaseDate() *string {
+	if r.movie.ReleaseDate.IsZero() {
+		return nil
+	}
+	date := r.movie.ReleaseDate.Format("2006-01-02")
+	return &date
+}
+
+func (r *movieResolver) Genres(ctx context.Context) ([]*genreResolver, error) {
+	genres, err := loaderFrom(ctx).load(ctx, r.movie.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*genreResolver, len(genres))
+	for i, g := range genres {
+		resolvers[i] = &genreResolver{genre: g}
+	}
+	return resolvers, nil
+}
+
+type genreResolver struct {
+	genre *models.Genre
+}
+
+func (r *genreResolver) ID() int32    { return int32(r.genre.ID) }
+func (r *genreResolver) Name() string { return r.genre.GenreName }
+
+type userResolver struct {
+	user *models.User
+}
+
+func (r *userResolver) ID() int32     { return int32(r.user.ID) }
+func (r *userResolver) Email() string { return r.user.Email }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"backend/models"
+	"backend/proto/moviepb"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//grpcPublicMethods are the reads anyone can call.Every other rpc needs a token like the /v1/admin routes do,
+//so a new rpc is never public by accident
+var grpcPublicMethods = map[string]bool{
+	moviepb.MovieService_Get_FullMethodName:        true,
+	moviepb.MovieService_List_FullMethodName:       true,
+	moviepb.MovieService_Search_FullMethodName:     true,
+	moviepb.MovieService_ListGenres_FullMethodName: true,
+}
+
+//movieService is the MovieService from proto/movie.proto on top of the same models the REST handlers use
+type movieService struct {
+	moviepb.UnimplementedMovieServiceServer
+	app *application
+}
+
+//serveGRPC starts the grpc server on its own port.It blocks like ListenAndServe does
+func (app *application) serveGRPC() error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", app.config.grpc.port))
+	if err != nil {
+		return err
+	}
+
+	app.logger.Println("Starting grpc server on port", app.config.grpc.port)
+	return app.newGRPCServer().Serve(lis)
+}
+
+//newGRPCServer is the grpc server with the MovieService and the auth check
+func (app *application) newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.UnaryInterceptor(app.grpcAuth))
+	moviepb.RegisterMovieServiceServer(srv, &movieService{app: app})
+	return srv
+}
+
+//grpcAuth is checkToken for grpc.The token comes in the "authorization" metadata as "Bearer <token>"
+func (app *application) grpcAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if grpcPublicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no auth header")
+	}
+
+	userID, _, err := app.validateToken(values[0])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return handler(context.WithValue(ctx, userIDKey, userID), req)
+}
+
+//grpcError turns model errors into grpc status errors.What went wrong inside is logged, the client only hears that something did
+func (app *application) grpcError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, models.ErrNotFound) {
+		return status.Error(codes.NotFound, "movie not found")
+	}
+	app.logger.Println("grpc:", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+//pageArgs checks page_size and offset, and fills in the default page size
+func pageArgs(pageSize, offset int32) (int, int, error) {
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize < 0 || pageSize > maxPageSize {
+		return 0, 0, status.Errorf(codes.InvalidArgument, "page_size must be between 1 and %d", maxPageSize)
+	}
+	if offset < 0 {
+		return 0, 0, status.Error(codes.InvalidArgument, "offset can't be negative")
+	}
+	return int(pageSize), int(offset), nil
+}
+
+func (s *movieService) Get(ctx context.Context, req *moviepb.GetMovieRequest) (*moviepb.Movie, error) {
+	movie, err := s.app.models.Movies.Get(ctx, int(req.Id))
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	return toProtoMovie(movie, genresFromMap(movie.MovieGenre)), nil
+}
+
+func (s *movieService) List(ctx context.Context, req *moviepb.ListMoviesRequest) (*moviepb.ListMoviesResponse, error) {
+	return s.list(ctx, models.MovieFilter{GenreID: int(req.GenreId)}, req.PageSize, req.Offset)
+}
+
+func (s *movieService) Search(ctx context.Context, req *moviepb.SearchMoviesRequest) (*moviepb.ListMoviesResponse, error) {
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+	return s.list(ctx, models.MovieFilter{GenreID: int(req.GenreId), Title: query}, req.PageSize, req.Offset)
+}
+
+//list is List and Search.The genres of the whole page come from one query
+func (s *movieService) list(ctx context.Context, filter models.MovieFilter, pageSize, offset int32) (*moviepb.ListMoviesResponse, error) {
+	limit, skip, err := pageArgs(pageSize, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	movies, total, err := s.app.models.Movies.ListMovies(ctx, filter, limit, skip)
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+
+	ids := make([]int, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	genres, err := s.app.models.Genres.GenresForMovies(ctx, ids)
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+
+	resp := &moviepb.ListMoviesResponse{Total: int32(total)}
+	for _, movie := range movies {
+		resp.Movies = append(resp.Movies, toProtoMovie(movie, genres[movie.ID]))
+	}
+	return resp, nil
+}
+
+func (s *movieService) Upsert(ctx context.Context, req *moviepb.UpsertMovieRequest) (*moviepb.Movie, error) {
+	in := req.Movie
+	if in == nil {
+		return nil, status.Error(codes.InvalidArgument, "movie is required")
+	}
+
+	//the same checks and saving as the REST handlers.Credits aren't in the proto, leaving them nil keeps them as they are
+	payload := MoviePayload{
+		ID:          FlexInt(in.Id),
+		Title:       in.Title,
+		Description: in.Description,
+		Runtime:     FlexInt(in.Runtime),
+		Rating:      FlexInt(in.Rating),
+		MPAARating:  in.MpaaRating,
+	}
+	if in.ReleaseDate != "" {
+		releaseDate, err := time.Parse(models.DateLayout, in.ReleaseDate)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "release_date must look like 2006-01-02")
+		}
+		payload.ReleaseDate = models.NewDate(releaseDate)
+	}
+	err := payload.validate()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	//updates start from the saved movie so created_at and the images stay as they are
+	movie := &models.Movie{}
+	if in.Id != 0 {
+		movie, err = s.app.models.Movies.Get(ctx, int(in.Id))
+		if err != nil {
+			return nil, s.app.grpcError(err)
+		}
+	}
+	err = s.app.saveMovie(ctx, movie, payload)
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+
+	return s.Get(ctx, &moviepb.GetMovieRequest{Id: int32(movie.ID)})
+}
+
+func (s *movieService) Delete(ctx context.Context, req *moviepb.DeleteMovieRequest) (*moviepb.DeleteMovieResponse, error) {
+	//just like the REST route the movie only goes to the trash
+	err := s.app.models.Movies.DeleteMovieDb(ctx, int(req.Id))
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+	return &moviepb.DeleteMovieResponse{}, nil
+}
+
+func (s *movieService) ListGenres(ctx context.Context, req *moviepb.ListGenresRequest) (*moviepb.ListGenresResponse, error) {
+	genres, err := s.app.models.Genres.GenreAll(ctx)
+	if err != nil {
+		return nil, s.app.grpcError(err)
+	}
+
+	resp := &moviepb.ListGenresResponse{}
+	for _, g := range genres {
+		resp.Genres = append(resp.Genres, &moviepb.Genre{Id: int32(g.ID), Name: g.GenreName})
+	}
+	return resp, nil
+}
+
+//genresFromMap turns Movie.MovieGenre into genres sorted by name
+func genresFromMap(m map[int]string) []*models.Genre {
+	genres := make([]*models.Genre, 0, len(m))
+	for id, name := range m {
+		genres = append(genres, &models.Genre{ID: id, GenreName: name})
+	}
+	sort.Slice(genres, func(i, j int) bool { return genres[i].GenreName < genres[j].GenreName })
+	return genres
+}
+
+func toProtoMovie(movie *models.Movie, genres []*models.Genre) *moviepb.Movie {
+	pb := &moviepb.Movie{
+		Id:            int32(movie.ID),
+		Title:         movie.Title,
+		Description:   movie.Description,
+		Year:          int32(movie.Year),
+		ReleaseDate:   movie.ReleaseDate.Format("2006-01-02"),
+		Runtime:       int32(movie.Runtime),
+		Rating:        int32(movie.Rating),
+		MpaaRating:    movie.MPAARating,
+		AverageRating: movie.AverageRating,
+		RatingCount:   int32(movie.RatingCount),
+		CreatedAt:     timestamppb.New(movie.Created_At),
+		UpdatedAt:     timestamppb.New(movie.Updated_At),
+	}
+	for _, g := range genres {
+		pb.Genres = append(pb.Genres, &moviepb.Genre{Id: int32(g.ID), Name: g.GenreName})
+	}
+	return pb
+}
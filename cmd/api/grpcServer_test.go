@@ -0,0 +1,150 @@
+package main
+
+import (
+	"backend/models"
+	"backend/proto/moviepb"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+//newGRPCClient runs the MovieService of s in memory and returns a client for it
+func newGRPCClient(t *testing.T, s *testServer) moviepb.MovieServiceClient {
+	lis := bufconn.Listen(1 << 20)
+	srv := s.app.newGRPCServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return moviepb.NewMovieServiceClient(conn)
+}
+
+//expectCode checks the grpc status code of err
+func expectCode(t *testing.T, err error, code codes.Code) {
+	t.Helper()
+	if status.Code(err) != code {
+		t.Fatalf("expected %s, got %v", code, err)
+	}
+}
+
+func TestGRPCService(t *testing.T) {
+	s := newTestServer(t, "sqlite")
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.db.AddUser(models.User{Email: "me@example.com", Password: string(hash)})
+	s.db.AddGenre("Drama")
+
+	var signin struct {
+		Response []byte `json:"response"`
+	}
+	s.expect(s.do("post /v1/signin", "/v1/signin", `{"email": "me@example.com", "password": "password"}`, false), http.StatusOK, &signin)
+
+	client := newGRPCClient(t, s)
+	ctx := context.Background()
+	signedIn := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+string(signin.Response))
+
+	movie := &moviepb.Movie{Title: " Heat ", ReleaseDate: "1995-12-15", Runtime: 170, Rating: 5}
+
+	//writes need a token, reads don't
+	_, err = client.Upsert(ctx, &moviepb.UpsertMovieRequest{Movie: movie})
+	expectCode(t, err, codes.Unauthenticated)
+	_, err = client.Delete(ctx, &moviepb.DeleteMovieRequest{Id: 1})
+	expectCode(t, err, codes.Unauthenticated)
+	_, err = client.Upsert(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer nope"), &moviepb.UpsertMovieRequest{Movie: movie})
+	expectCode(t, err, codes.Unauthenticated)
+
+	_, err = client.Get(ctx, &moviepb.GetMovieRequest{Id: 9999})
+	expectCode(t, err, codes.NotFound)
+
+	//the same checks as the REST handlers
+	for _, bad := range []*moviepb.Movie{
+		{Title: "   ", ReleaseDate: "1995-12-15"},
+		{Title: "Heat"},
+		{Title: "Heat", ReleaseDate: "15.12.1995"},
+		{Title: "Heat", ReleaseDate: "1995-12-15", Runtime: -1},
+	} {
+		_, err = client.Upsert(signedIn, &moviepb.UpsertMovieRequest{Movie: bad})
+		expectCode(t, err, codes.InvalidArgument)
+	}
+
+	created, err := client.Upsert(signedIn, &moviepb.UpsertMovieRequest{Movie: movie})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Id == 0 || created.Title != "Heat" || created.Year != 1995 || created.Runtime != 170 {
+		t.Fatalf("unexpected movie %+v", created)
+	}
+
+	created.Runtime = 171
+	updated, err := client.Upsert(signedIn, &moviepb.UpsertMovieRequest{Movie: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.Get(ctx, &moviepb.GetMovieRequest{Id: created.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Id != created.Id || got.Runtime != 171 || !got.CreatedAt.AsTime().Equal(created.CreatedAt.AsTime()) {
+		t.Errorf("expected the update on the same movie, got %+v", got)
+	}
+
+	list, err := client.Search(ctx, &moviepb.SearchMoviesRequest{Query: "hea"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 || list.Movies[0].Id != created.Id {
+		t.Errorf("expected Heat, got %+v", list)
+	}
+
+	_, err = client.Upsert(signedIn, &moviepb.UpsertMovieRequest{Movie: &moviepb.Movie{Id: 9999, Title: "Gone", ReleaseDate: "2000-01-01"}})
+	expectCode(t, err, codes.NotFound)
+
+	_, err = client.Delete(signedIn, &moviepb.DeleteMovieRequest{Id: created.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Get(ctx, &moviepb.GetMovieRequest{Id: created.Id})
+	expectCode(t, err, codes.NotFound)
+	_, err = client.Delete(signedIn, &moviepb.DeleteMovieRequest{Id: created.Id})
+	expectCode(t, err, codes.NotFound)
+}
+
+//failingMovies is a movie repository whose database is broken
+type failingMovies struct {
+	models.MovieRepository
+}
+
+func (failingMovies) ListMovies(ctx context.Context, filter models.MovieFilter, limit, offset int) ([]*models.Movie, int, error) {
+	return nil, 0, errors.New(`pq: relation "movies" does not exist`)
+}
+
+//TestGRPCInternalErrors checks that what went wrong inside stays on the server
+func TestGRPCInternalErrors(t *testing.T) {
+	s := newTestServer(t, "sqlite")
+	s.app.models.Movies = failingMovies{s.app.models.Movies}
+	client := newGRPCClient(t, s)
+
+	_, err := client.List(context.Background(), &moviepb.ListMoviesRequest{})
+	expectCode(t, err, codes.Internal)
+	if msg := status.Convert(err).Message(); msg != "internal error" {
+		t.Errorf("expected a generic message, got %q", msg)
+	}
+}
@@ -0,0 +1,1135 @@
+package main
+
+import (
+	"backend/migrations"
+	"backend/models"
+	"backend/storage"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/julienschmidt/httprouter"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//testServer runs the whole api on one of the backends.Every request it makes is remembered by route in coveredRoutes so
+//TestRoutesCovered can check that no route in routes() went untested
+type testServer struct {
+	t       *testing.T
+	backend string
+	app     *application
+	handler http.Handler
+	db      seeder
+	token   string
+}
+
+//seeder adds the data the api has no endpoints for
+type seeder interface {
+	AddUser(user models.User) int
+	AddGenre(name string) int
+	SetMovieGenres(movieID int, genreIDs ...int)
+}
+
+//sqliteSeeder seeds a sqlite database made by models.Migrate
+type sqliteSeeder struct {
+	t  *testing.T
+	db *sql.DB
+}
+
+func (s sqliteSeeder) insert(query string, args ...interface{}) int {
+	var id int
+	err := s.db.QueryRow(query+" returning id", args...).Scan(&id)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return id
+}
+
+func (s sqliteSeeder) AddUser(user models.User) int {
+	return s.insert(`insert into users (email, password, is_admin) values ($1, $2, $3)`, user.Email, user.Password, user.Admin)
+}
+
+func (s sqliteSeeder) AddGenre(name string) int {
+	return s.insert(`insert into genres (genre_name) values ($1)`, name)
+}
+
+func (s sqliteSeeder) SetMovieGenres(movieID int, genreIDs ...int) {
+	for _, id := range genreIDs {
+		s.insert(`insert into movies_genres (movie_id, genre_id) values ($1, $2)`, movieID, id)
+	}
+}
+
+//newTestServer starts the api on backend, "memory", "sqlite" or "cached", which is sqlite behind the lru cache
+func newTestServer(t *testing.T, backend string) *testServer {
+	var m models.Models
+	var db seeder
+	metrics := &models.QueryMetrics{}
+
+	switch backend {
+	case "memory":
+		mem := models.NewMemoryModel()
+		m, db = models.NewMemoryModels(mem), mem
+	case "sqlite", "cached":
+		pool, err := models.OpenSQLite(filepath.Join(t.TempDir(), "movies.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pool.Close() })
+
+		_, err = models.Migrate(context.Background(), pool, models.SQLite, migrations.FS)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err = models.NewModels(context.Background(), pool, models.Config{Dialect: models.SQLite, Hook: metrics})
+		if err != nil {
+			t.Fatal(err)
+		}
+		db = sqliteSeeder{t: t, db: pool}
+
+		if backend == "cached" {
+			m = models.NewCachedModels(m, models.NewLRUCache(100), time.Minute)
+		}
+	}
+
+	blobs, err := storage.NewFileStore(t.TempDir(), "http://localhost:8080/v1/images")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &application{
+		logger:       log.New(io.Discard, "", 0),
+		models:       m,
+		blobs:        blobs,
+		queryMetrics: metrics,
+	}
+	app.config.env = "test"
+	app.config.jwt.secret = "test-secret"
+	app.config.storage.maxUpload = 1 << 20
+	app.config.cacheControl = defaultCacheControl
+	app.config.compress.minSize = 256
+
+	return &testServer{
+		t:       t,
+		backend: backend,
+		app:     app,
+		handler: app.routes(),
+		db:      db,
+	}
+}
+
+//do sends a request for route, which is written like registeredRoutes writes them.Signed in requests send the token
+func (s *testServer) do(route, path, body string, signedIn bool, header ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	method := strings.ToUpper(strings.SplitN(route, " ", 2)[0])
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	if signedIn {
+		r.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	coveredRoutes[route] = true
+	return w
+}
+
+//decompress undoes the Content-Encoding of a response
+func decompress(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case "":
+		return body
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("can't decompress %s: %v", encoding, err)
+	}
+	return plain
+}
+
+//expect checks the status and decodes the body into dst when it isn't nil
+func (s *testServer) expect(w *httptest.ResponseRecorder, status int, dst interface{}) {
+	s.t.Helper()
+
+	if w.Code != status {
+		s.t.Fatalf("expected status %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+	if dst != nil {
+		err := json.Unmarshal(w.Body.Bytes(), dst)
+		if err != nil {
+			s.t.Fatalf("can't decode %q: %v", w.Body.String(), err)
+		}
+	}
+}
+
+//movie is the envelope of every endpoint answering with one movie
+type movieEnvelope struct {
+	Movie models.Movie `json:"movie"`
+}
+
+type okEnvelope struct {
+	Response jsonResp `json:"response"`
+}
+
+func (s *testServer) expectOK(w *httptest.ResponseRecorder) {
+	s.t.Helper()
+
+	var resp okEnvelope
+	s.expect(w, http.StatusOK, &resp)
+	if !resp.Response.OK {
+		s.t.Fatalf("expected ok, got %s", w.Body.String())
+	}
+}
+
+//createMovie adds a movie through the api and returns it
+func (s *testServer) createMovie(title, releaseDate string) models.Movie {
+	s.t.Helper()
+
+	var resp movieEnvelope
+	body := fmt.Sprintf(`{"title": %q, "release_date": %q, "runtime": 100, "rating": 4}`, title, releaseDate)
+	s.expect(s.do("post /v1/movies", "/v1/movies", body, true), http.StatusCreated, &resp)
+	return resp.Movie
+}
+
+//backends are what every handler test runs on, the in memory models and a sqlite database, with and without the cache
+var backends = []string{"memory", "sqlite", "cached"}
+
+//coveredRoutes has every route a handler test sent a request to, TestRoutesCovered checks it against routes()
+var coveredRoutes = make(map[string]bool)
+
+//handlerTestFailed is set when a handler test failed, the routes it didn't get to aren't worth reporting then
+var handlerTestFailed bool
+
+//handlerTest runs f on a fresh server for every backend.The server has the users of seedUsers and is signed in as the admin
+func handlerTest(t *testing.T, f func(t *testing.T, s *testServer)) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			s := newTestServer(t, backend)
+			s.seedUsers()
+			s.token = s.signIn("me@example.com")
+			f(t, s)
+			if t.Failed() {
+				handlerTestFailed = true
+			}
+		})
+	}
+}
+
+//run runs a subtest of a handler test.Subtests share the server and run in order, later ones use what earlier ones made
+func (s *testServer) run(t *testing.T, name string, f func(t *testing.T)) {
+	t.Run(name, func(t *testing.T) {
+		parent := s.t
+		s.t = t
+		defer func() { s.t = parent }()
+		f(t)
+	})
+}
+
+//seedUsers adds the admin me@example.com and reader@example.com, who isn't one.Both have the password "password"
+func (s *testServer) seedUsers() {
+	s.t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.db.AddUser(models.User{Email: "me@example.com", Password: string(hash), Admin: true})
+	s.db.AddUser(models.User{Email: "reader@example.com", Password: string(hash)})
+}
+
+//signIn signs in one of the users of seedUsers and returns the token
+func (s *testServer) signIn(email string) string {
+	s.t.Helper()
+
+	var resp struct {
+		Response []byte `json:"response"`
+	}
+	body := fmt.Sprintf(`{"email": %q, "password": "password"}`, email)
+	s.expect(s.do("post /v1/signin", "/v1/signin", body, false), http.StatusOK, &resp)
+	if len(resp.Response) == 0 {
+		s.t.Fatal("no token")
+	}
+	return string(resp.Response)
+}
+
+//testMovies are the genres and movies most handler tests start with
+type testMovies struct {
+	drama, comedy int
+	//The Batman is a drama with Robert Pattinson in its cast
+	batman models.Movie
+	joker  models.Movie
+}
+
+//seedMovies adds the genres and movies of testMovies
+func (s *testServer) seedMovies() testMovies {
+	s.t.Helper()
+
+	var m testMovies
+	m.drama = s.db.AddGenre("Drama")
+	m.comedy = s.db.AddGenre("Comedy")
+
+	var created movieEnvelope
+	s.expect(s.do("post /v1/movies", "/v1/movies", `{"title": "The Batman", "release_date": "2022-03-04", "runtime": 176, "rating": 4,
+		"credits": [{"name": "Robert Pattinson", "role": "actor", "character": "Bruce Wayne"}]}`, true), http.StatusCreated, &created)
+	m.batman = created.Movie
+	s.db.SetMovieGenres(m.batman.ID, m.drama)
+
+	m.joker = s.createMovie("Joker", "2019-10-04")
+	return m
+}
+
+func TestStatus(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		var status AppStatus
+		s.expect(s.do("get /status", "/status", "", false), http.StatusOK, &status)
+		if status.Status != "Available" || status.Environment != "test" {
+			t.Errorf("unexpected status %+v", status)
+		}
+	})
+}
+
+func TestSignIn(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		s.expect(s.do("post /v1/signin", "/v1/signin", `{"email": "me@example.com", "password": "wrong"}`, false), http.StatusBadRequest, nil)
+		s.expect(s.do("post /v1/signin", "/v1/signin", `{"email": "nobody@example.com", "password": "password"}`, false), http.StatusBadRequest, nil)
+		//emails don't care about case
+		s.signIn("ME@example.com")
+	})
+}
+
+func TestMovieHandlers(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		drama := s.db.AddGenre("Drama")
+		var batman, joker models.Movie
+
+		s.run(t, "create, replace and patch", func(t *testing.T) {
+			s.expect(s.do("post /v1/movies", "/v1/movies", `{"title": "No token", "release_date": "2020-01-01"}`, false), http.StatusBadRequest, nil)
+			s.expect(s.do("post /v1/movies", "/v1/movies", `{"release_date": "2020-01-01"}`, true), http.StatusBadRequest, nil)
+			s.expect(s.do("post /v1/movies", "/v1/movies", `{"title": "Too good", "release_date": "2020-01-01", "rating": 6}`, true), http.StatusBadRequest, nil)
+
+			w := s.do("post /v1/movies", "/v1/movies", `{"title": "The Batman", "release_date": "2022-03-04", "runtime": 176, "rating": 4,
+				"credits": [{"name": "Robert Pattinson", "role": "actor", "character": "Bruce Wayne"}]}`, true)
+			var created movieEnvelope
+			s.expect(w, http.StatusCreated, &created)
+			batman = created.Movie
+			if got := w.Header().Get("Location"); got != fmt.Sprintf("/v1/movies/%d", batman.ID) {
+				t.Errorf("got Location %q", got)
+			}
+			if batman.Year != 2022 || len(batman.Cast) != 1 {
+				t.Errorf("unexpected movie %+v", batman)
+			}
+			s.db.SetMovieGenres(batman.ID, drama)
+
+			var replaced movieEnvelope
+			path := fmt.Sprintf("/v1/movies/%d", batman.ID)
+			s.expect(s.do("put /v1/movies/{id}", path, `{"title": "The Batman", "release_date": "2022-03-04", "runtime": 177}`, true), http.StatusOK, &replaced)
+			if replaced.Movie.Runtime != 177 || replaced.Movie.Rating != 0 || replaced.Movie.Version != batman.Version+1 {
+				t.Errorf("PUT should replace every field, got %+v", replaced.Movie)
+			}
+			s.expect(s.do("put /v1/movies/{id}", "/v1/movies/9999", `{"title": "Gone", "release_date": "2022-03-04"}`, true), http.StatusNotFound, nil)
+
+			var patched movieEnvelope
+			s.expect(s.do("patch /v1/movies/{id}", path, `{"rating": 5, "description": "Vengeance"}`, true,
+				"Content-Type", "application/merge-patch+json"), http.StatusOK, &patched)
+			if patched.Movie.Rating != 5 || patched.Movie.Runtime != 177 || patched.Movie.Description != "Vengeance" {
+				t.Errorf("PATCH should only touch the given fields, got %+v", patched.Movie)
+			}
+			s.expect(s.do("patch /v1/movies/{id}", path, `{"colour": "black"}`, true), http.StatusBadRequest, nil)
+			s.expect(s.do("patch /v1/movies/{id}", path, `{"title": null}`, true), http.StatusBadRequest, nil)
+
+			joker = s.createMovie("Joker", "2019-10-04")
+		})
+
+		s.run(t, "editmovie", func(t *testing.T) {
+			var created movieEnvelope
+			s.expect(s.do("post /v1/admin/editmovie", "/v1/admin/editmovie",
+				`{"id": "0", "title": "Dune", "release_date": "2021-10-22", "runtime": "155", "rating": "4"}`, true), http.StatusCreated, &created)
+			if created.Movie.ID == 0 || created.Movie.Title != "Dune" || created.Movie.Version != 1 {
+				t.Errorf("expected the new movie back, got %+v", created.Movie)
+			}
+
+			var updated movieEnvelope
+			body := fmt.Sprintf(`{"id": "%d", "title": "Joker", "release_date": "2019-10-04", "runtime": "122", "rating": "5"}`, joker.ID)
+			s.expect(s.do("post /v1/admin/editmovie", "/v1/admin/editmovie", body, true), http.StatusOK, &updated)
+			if updated.Movie.ID != joker.ID || updated.Movie.Runtime != 122 || updated.Movie.Version != joker.Version+1 {
+				t.Errorf("expected the updated movie back, got %+v", updated.Movie)
+			}
+			s.expect(s.do("post /v1/admin/editmovie", "/v1/admin/editmovie", `{"id": "9999", "title": "Gone", "release_date": "2019-10-04"}`, true), http.StatusNotFound, nil)
+		})
+
+		s.run(t, "read movies", func(t *testing.T) {
+			var all struct {
+				Movies []models.Movie `json:"movies"`
+			}
+			s.expect(s.do("get /v1/movies", "/v1/movies", "", false), http.StatusOK, &all)
+			if len(all.Movies) != 3 || all.Movies[0].Title != "Dune" {
+				t.Errorf("expected 3 movies by title, got %+v", all.Movies)
+			}
+
+			var one movieEnvelope
+			s.expect(s.do("get /v1/movies/{id}", fmt.Sprintf("/v1/movies/%d", joker.ID), "", false), http.StatusOK, &one)
+			if one.Movie.Runtime != 122 {
+				t.Errorf("editmovie didn't update, got %+v", one.Movie)
+			}
+			s.expect(s.do("get /v1/movies/{id}", "/v1/movies/9999", "", false), http.StatusBadRequest, nil)
+
+			//dates go out without a time
+			w := s.do("get /v1/movies/{id}", fmt.Sprintf("/v1/movies/%d", joker.ID), "", false)
+			s.expect(w, http.StatusOK, nil)
+			if !strings.Contains(w.Body.String(), `"release_date":"2019-10-04"`) {
+				t.Errorf("expected a date only release_date, got %s", w.Body.String())
+			}
+
+			//xml comes from the same handler
+			w = s.do("get /v1/movies/{id}", fmt.Sprintf("/v1/movies/%d", joker.ID), "", false, "Accept", "application/xml")
+			s.expect(w, http.StatusOK, nil)
+			if !strings.Contains(w.Body.String(), "<title>Joker</title>") || !strings.Contains(w.Body.String(), "<release_date>2019-10-04</release_date>") {
+				t.Errorf("expected xml, got %s", w.Body.String())
+			}
+		})
+	})
+}
+
+func TestConditionalGET(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		joker := s.seedMovies().joker
+
+		path := fmt.Sprintf("/v1/movies/%d", joker.ID)
+		w := s.do("get /v1/movies/{id}", path, "", false)
+		s.expect(w, http.StatusOK, nil)
+		etag := w.Header().Get("ETag")
+		if !strings.HasPrefix(etag, `"`) || w.Header().Get("Cache-Control") != "public, max-age=60" {
+			t.Fatalf("expected caching headers, got %v", w.Header())
+		}
+
+		w = s.do("get /v1/movies/{id}", path, "", false, "If-None-Match", etag)
+		s.expect(w, http.StatusNotModified, nil)
+		if w.Body.Len() != 0 || w.Header().Get("ETag") != etag {
+			t.Errorf("a 304 has the ETag and no body, got %v %q", w.Header(), w.Body.String())
+		}
+		s.expect(s.do("get /v1/movies/{id}", path, "", false, "If-None-Match", `"other", W/`+etag), http.StatusNotModified, nil)
+
+		//without If-None-Match the date decides
+		modified := w.Header().Get("Last-Modified")
+		if modified == "" {
+			t.Fatalf("expected a Last-Modified, got %v", w.Header())
+		}
+		s.expect(s.do("get /v1/movies/{id}", path, "", false, "If-Modified-Since", modified), http.StatusNotModified, nil)
+		s.expect(s.do("get /v1/movies/{id}", path, "", false, "If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT"), http.StatusOK, nil)
+		//and with it the date doesn't count
+		s.expect(s.do("get /v1/movies/{id}", path, "", false, "If-None-Match", `"other"`, "If-Modified-Since", modified), http.StatusOK, nil)
+
+		//a review changes the rating, so it changes the ETag too.That it moves updated_at is tested in the models
+		s.expectOK(s.do("post /v1/movies/{id}/reviews", path+"/reviews", `{"rating": 3}`, true))
+		w = s.do("get /v1/movies/{id}", path, "", false, "If-None-Match", etag)
+		s.expect(w, http.StatusOK, nil)
+		etag = w.Header().Get("ETag")
+
+		//the whole document or nothing
+		w = s.do("get /v1/movies/{id}", path, "", false, "Range", "bytes=0-10")
+		s.expect(w, http.StatusOK, &movieEnvelope{})
+		if w.Header().Get("Content-Range") != "" || w.Header().Get("Accept-Ranges") != "" {
+			t.Errorf("expected no range support, got %v", w.Header())
+		}
+
+		//xml is other content so the json ETag doesn't match it
+		s.expect(s.do("get /v1/movies/{id}", path, "", false, "Accept", "application/xml", "If-None-Match", etag), http.StatusOK, nil)
+
+		s.expect(s.do("patch /v1/movies/{id}", path, `{"runtime": 123}`, true, "Content-Type", "application/merge-patch+json"), http.StatusOK, nil)
+		w = s.do("get /v1/movies/{id}", path, "", false, "If-None-Match", etag)
+		s.expect(w, http.StatusOK, nil)
+		if w.Header().Get("ETag") == etag {
+			t.Error("the ETag should change with the movie")
+		}
+
+		w = s.do("get /v1/movies", "/v1/movies", "", false)
+		s.expect(s.do("get /v1/movies", "/v1/movies", "", false, "If-None-Match", w.Header().Get("ETag")), http.StatusNotModified, nil)
+		s.expect(s.do("get /v1/movies", "/v1/movies", "", false, "If-Modified-Since", w.Header().Get("Last-Modified")), http.StatusNotModified, nil)
+		s.expect(s.do("get /v1/movies/{id}", "/v1/movies/9999", "", false, "If-None-Match", "*"), http.StatusBadRequest, nil)
+	})
+}
+
+func TestCompression(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		s.seedMovies()
+
+		plain := s.do("get /v1/movies", "/v1/movies", "", false)
+		s.expect(plain, http.StatusOK, nil)
+		if plain.Header().Get("Content-Encoding") != "" || !varies(plain.Header(), "Accept-Encoding") {
+			t.Fatalf("a client not asking for compression gets it plain, but Vary has to say it could be compressed, got %v", plain.Header())
+		}
+
+		for _, tc := range []struct{ accept, encoding string }{
+			{"gzip", "gzip"},
+			{"br", "br"},
+			{"zstd", "zstd"},
+			{"gzip, deflate, br, zstd", "br"},
+			{"gzip;q=1, br;q=0.5", "gzip"},
+			{"br;q=0, *", "zstd"},
+			{"identity", ""},
+			{"*;q=0", ""},
+		} {
+			w := s.do("get /v1/movies", "/v1/movies", "", false, "Accept-Encoding", tc.accept)
+			s.expect(w, http.StatusOK, nil)
+			if got := w.Header().Get("Content-Encoding"); got != tc.encoding {
+				t.Fatalf("Accept-Encoding %q: expected %q, got %q", tc.accept, tc.encoding, got)
+			}
+			if body := decompress(t, tc.encoding, w.Body.Bytes()); !bytes.Equal(body, plain.Body.Bytes()) {
+				t.Errorf("Accept-Encoding %q: body differs from the plain one: %q", tc.accept, body)
+			}
+		}
+
+		w := s.do("get /v1/movies", "/v1/movies", "", false, "Accept-Encoding", "gzip")
+		etag := w.Header().Get("ETag")
+		if etag != "W/"+plain.Header().Get("ETag") || w.Header().Get("Content-Length") != "" {
+			t.Errorf("a compressed response has a weak ETag and no Content-Length, got %v", w.Header())
+		}
+		//the 304 has the ETag and Vary the 200 had, weak for a compressed one and strong for a plain one
+		w = s.do("get /v1/movies", "/v1/movies", "", false, "Accept-Encoding", "gzip", "If-None-Match", etag)
+		s.expect(w, http.StatusNotModified, nil)
+		if w.Header().Get("ETag") != etag || !varies(w.Header(), "Accept-Encoding") {
+			t.Errorf("expected ETag %s and Vary: Accept-Encoding on the 304, got %v", etag, w.Header())
+		}
+		w = s.do("get /v1/movies", "/v1/movies", "", false, "If-None-Match", etag)
+		s.expect(w, http.StatusNotModified, nil)
+		if w.Header().Get("ETag") != plain.Header().Get("ETag") {
+			t.Errorf("expected the strong ETag %s on a plain 304, got %v", plain.Header().Get("ETag"), w.Header())
+		}
+
+		//short responses aren't worth it
+		w = s.do("get /v1/genres", "/v1/genres", "", false, "Accept-Encoding", "gzip")
+		s.expect(w, http.StatusOK, nil)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.Len() >= 256 {
+			t.Errorf("expected a short plain response, got %v with %d bytes", w.Header(), w.Body.Len())
+		}
+
+		//checkToken's Vary stays
+		w = s.do("get /v1/admin/movies/export", "/v1/admin/movies/export?format=ndjson", "", true, "Accept-Encoding", "gzip")
+		s.expect(w, http.StatusOK, nil)
+		if w.Header().Get("Content-Encoding") != "gzip" || !varies(w.Header(), "Authorization") || !varies(w.Header(), "Accept-Encoding") {
+			t.Errorf("expected a gzipped export varying by Authorization and Accept-Encoding, got %v", w.Header())
+		}
+		if body := decompress(t, "gzip", w.Body.Bytes()); !bytes.Contains(body, []byte("The Batman")) {
+			t.Errorf("unexpected export %q", body)
+		}
+	})
+}
+
+func TestGenreHandlers(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		m := s.seedMovies()
+
+		var genres struct {
+			Genres []models.Genre `json:"genres"`
+		}
+		s.expect(s.do("get /v1/genres", "/v1/genres", "", false), http.StatusOK, &genres)
+		if len(genres.Genres) != 2 || genres.Genres[0].GenreName != "Comedy" {
+			t.Errorf("unexpected genres %+v", genres.Genres)
+		}
+
+		var movies struct {
+			Movies []models.Movie `json:"movies"`
+		}
+		s.expect(s.do("get /v1/genres/{genre_id}", fmt.Sprintf("/v1/genres/%d", m.drama), "", false), http.StatusOK, &movies)
+		if len(movies.Movies) != 1 || movies.Movies[0].ID != m.batman.ID {
+			t.Errorf("expected only The Batman, got %+v", movies.Movies)
+		}
+	})
+}
+
+func TestPeopleHandlers(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		personID := s.seedMovies().batman.Cast[0].PersonID
+
+		var resp struct {
+			Person models.Person `json:"person"`
+		}
+		s.expect(s.do("get /v1/people/{id}", fmt.Sprintf("/v1/people/%d", personID), "", false), http.StatusOK, &resp)
+		if resp.Person.Name != "Robert Pattinson" || len(resp.Person.Filmography) != 1 {
+			t.Errorf("unexpected person %+v", resp.Person)
+		}
+		s.expect(s.do("get /v1/people/{id}", "/v1/people/9999", "", false), http.StatusNotFound, nil)
+	})
+}
+
+func TestReviewHandlers(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		batman := s.seedMovies().batman
+		var reviewID int
+
+		s.run(t, "reviews", func(t *testing.T) {
+			path := fmt.Sprintf("/v1/movies/%d/reviews", batman.ID)
+			s.expect(s.do("post /v1/movies/{id}/reviews", path, `{"rating": 9}`, true), http.StatusBadRequest, nil)
+			s.expectOK(s.do("post /v1/movies/{id}/reviews", path, `{"rating": 4, "body": "Dark"}`, true))
+			s.expectOK(s.do("post /v1/movies/{id}/reviews", path, `{"rating": 5, "body": "Darker"}`, true))
+
+			var resp struct {
+				Reviews struct {
+					Items []models.Review `json:"items"`
+					Total int             `json:"total"`
+				} `json:"reviews"`
+			}
+			s.expect(s.do("get /v1/movies/{id}/reviews", path, "", false), http.StatusOK, &resp)
+			if resp.Reviews.Total != 1 || resp.Reviews.Items[0].Body != "Darker" {
+				t.Fatalf("a second review should edit the first, got %+v", resp.Reviews)
+			}
+			reviewID = resp.Reviews.Items[0].ID
+
+			var movie movieEnvelope
+			s.expect(s.do("get /v1/movies/{id}", fmt.Sprintf("/v1/movies/%d", batman.ID), "", false), http.StatusOK, &movie)
+			if movie.Movie.RatingCount != 1 || movie.Movie.AverageRating != 5 {
+				t.Errorf("expected the rating on the movie, got %+v", movie.Movie)
+			}
+		})
+
+		s.run(t, "moderation", func(t *testing.T) {
+			//signed in isn't enough, only admins moderate
+			adminToken := s.token
+			s.token = s.signIn("reader@example.com")
+			s.expect(s.do("post /v1/admin/reviews/{id}/hide", fmt.Sprintf("/v1/admin/reviews/%d/hide", reviewID), "", true), http.StatusForbidden, nil)
+			s.expect(s.do("delete /v1/admin/reviews/{id}", fmt.Sprintf("/v1/admin/reviews/%d", reviewID), "", true), http.StatusForbidden, nil)
+			s.token = adminToken
+			s.expect(s.do("post /v1/admin/reviews/{id}/hide", fmt.Sprintf("/v1/admin/reviews/%d/hide", reviewID), "", false), http.StatusBadRequest, nil)
+
+			s.expectOK(s.do("post /v1/admin/reviews/{id}/hide", fmt.Sprintf("/v1/admin/reviews/%d/hide", reviewID), "", true))
+
+			var reviews struct {
+				Reviews struct {
+					Total int `json:"total"`
+				} `json:"reviews"`
+			}
+			s.expect(s.do("get /v1/movies/{id}/reviews", fmt.Sprintf("/v1/movies/%d/reviews", batman.ID), "", false), http.StatusOK, &reviews)
+			if reviews.Reviews.Total != 0 {
+				t.Errorf("hidden reviews shouldn't be listed")
+			}
+
+			s.expectOK(s.do("delete /v1/admin/reviews/{id}", fmt.Sprintf("/v1/admin/reviews/%d", reviewID), "", true))
+			s.expect(s.do("delete /v1/admin/reviews/{id}", fmt.Sprintf("/v1/admin/reviews/%d", reviewID), "", true), http.StatusNotFound, nil)
+		})
+	})
+}
+
+func TestListHandlers(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		m := s.seedMovies()
+
+		var lists struct {
+			Lists []models.List `json:"lists"`
+		}
+		s.expect(s.do("get /v1/me/lists", "/v1/me/lists", "", true), http.StatusOK, &lists)
+		if len(lists.Lists) != 1 || !lists.Lists[0].Default {
+			t.Fatalf("expected the favourites list, got %+v", lists.Lists)
+		}
+
+		var created struct {
+			List models.List `json:"list"`
+		}
+		s.expect(s.do("post /v1/me/lists", "/v1/me/lists", `{"name": "Weekend"}`, true), http.StatusCreated, &created)
+		list := created.List
+		path := fmt.Sprintf("/v1/me/lists/%d", list.ID)
+
+		s.expectOK(s.do("post /v1/me/lists/{id}/movies", path+"/movies", fmt.Sprintf(`{"movie_id": %d}`, m.batman.ID), true))
+		s.expectOK(s.do("post /v1/me/lists/{id}/movies", path+"/movies", fmt.Sprintf(`{"movie_id": %d}`, m.joker.ID), true))
+		s.expect(s.do("post /v1/me/lists/{id}/movies", path+"/movies", `{"movie_id": 9999}`, true), http.StatusNotFound, nil)
+		s.expectOK(s.do("put /v1/me/lists/{id}/movies", path+"/movies", fmt.Sprintf(`{"movie_ids": [%d, %d]}`, m.joker.ID, m.batman.ID), true))
+		s.expect(s.do("put /v1/me/lists/{id}/movies", path+"/movies", fmt.Sprintf(`{"movie_ids": [%d]}`, m.joker.ID), true), http.StatusBadRequest, nil)
+
+		var got struct {
+			List models.List `json:"list"`
+		}
+		s.expect(s.do("get /v1/me/lists/{id}", path, "", true), http.StatusOK, &got)
+		if len(got.List.Movies) != 2 || got.List.Movies[0].ID != m.joker.ID {
+			t.Errorf("expected Joker first, got %+v", got.List.Movies)
+		}
+
+		//private lists can't be seen with the slug
+		s.expect(s.do("get /v1/lists/{slug}", "/v1/lists/"+list.Slug, "", false), http.StatusNotFound, nil)
+		s.expect(s.do("put /v1/me/lists/{id}", path, `{"name": "Weekend", "public": true}`, true), http.StatusOK, nil)
+		s.expect(s.do("get /v1/lists/{slug}", "/v1/lists/"+list.Slug, "", false), http.StatusOK, &got)
+		if !got.List.Public {
+			t.Errorf("expected a public list, got %+v", got.List)
+		}
+
+		s.expectOK(s.do("delete /v1/me/lists/{id}/movies/{movie_id}", fmt.Sprintf("%s/movies/%d", path, m.joker.ID), "", true))
+		s.expect(s.do("delete /v1/me/lists/{id}/movies/{movie_id}", fmt.Sprintf("%s/movies/%d", path, m.joker.ID), "", true), http.StatusNotFound, nil)
+
+		s.expectOK(s.do("delete /v1/me/lists/{id}", path, "", true))
+		s.expect(s.do("get /v1/me/lists/{id}", path, "", true), http.StatusNotFound, nil)
+	})
+}
+
+func TestRevisionHandlers(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		batman := s.seedMovies().batman
+		moviePath := fmt.Sprintf("/v1/movies/%d", batman.ID)
+		s.expect(s.do("put /v1/movies/{id}", moviePath, `{"title": "The Batman", "release_date": "2022-03-04", "runtime": 177}`, true), http.StatusOK, nil)
+		s.expect(s.do("patch /v1/movies/{id}", moviePath, `{"rating": 5}`, true, "Content-Type", "application/merge-patch+json"), http.StatusOK, nil)
+
+		var resp struct {
+			Revisions []models.MovieRevision `json:"revisions"`
+		}
+		path := fmt.Sprintf("/v1/admin/movies/%d/revisions", batman.ID)
+		s.expect(s.do("get /v1/admin/movies/{id}/revisions", path, "", true), http.StatusOK, &resp)
+		if len(resp.Revisions) != 3 {
+			t.Fatalf("expected the first version and two edits, got %+v", resp.Revisions)
+		}
+
+		s.expectOK(s.do("post /v1/admin/movies/{id}/revisions/{revision}/rollback", path+"/1/rollback", "", true))
+		s.expect(s.do("post /v1/admin/movies/{id}/revisions/{revision}/rollback", path+"/99/rollback", "", true), http.StatusNotFound, nil)
+
+		var movie movieEnvelope
+		s.expect(s.do("get /v1/movies/{id}", moviePath, "", false), http.StatusOK, &movie)
+		if movie.Movie.Runtime != 176 || movie.Movie.Rating != 4 {
+			t.Errorf("expected the first version back, got %+v", movie.Movie)
+		}
+	})
+}
+
+func TestImageHandlers(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		batman := s.seedMovies().batman
+
+		img := image.NewRGBA(image.Rect(0, 0, 600, 900))
+		img.Set(1, 1, color.RGBA{R: 255, A: 255})
+		var buf bytes.Buffer
+		png.Encode(&buf, img)
+
+		upload := func(route, kind string, data []byte) *httptest.ResponseRecorder {
+			body, contentType := imageForm(data)
+			return s.do(route, fmt.Sprintf("/v1/admin/movies/%d/%s", batman.ID, kind), body, true, "Content-Type", contentType)
+		}
+
+		var poster struct {
+			Poster map[string]string `json:"poster"`
+		}
+		s.expect(upload("post /v1/admin/movies/{id}/poster", "poster", buf.Bytes()), http.StatusOK, &poster)
+		if poster.Poster["w185"] == "" {
+			t.Fatalf("expected thumbnail urls, got %+v", poster.Poster)
+		}
+		s.expect(upload("post /v1/admin/movies/{id}/backdrop", "backdrop", buf.Bytes()), http.StatusOK, nil)
+
+		s.expect(upload("post /v1/admin/movies/{id}/poster", "poster", []byte("GIF89a not really")), http.StatusUnsupportedMediaType, nil)
+		//a few bytes on disk, gigabytes once decoded
+		var huge bytes.Buffer
+		png.Encode(&huge, image.NewGray(image.Rect(0, 0, maxImageSide+1, 1)))
+		s.expect(upload("post /v1/admin/movies/{id}/poster", "poster", huge.Bytes()), http.StatusUnsupportedMediaType, nil)
+
+		path := strings.TrimPrefix(poster.Poster["w185"], "http://localhost:8080")
+		w := s.do("get /v1/images/{filepath}", path, "", false)
+		s.expect(w, http.StatusOK, nil)
+		if w.Header().Get("Content-Type") != "image/jpeg" {
+			t.Errorf("expected a jpeg, got %q", w.Header().Get("Content-Type"))
+		}
+	})
+}
+
+func TestImportExport(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		drama := s.seedMovies().drama
+
+		ndjson := `{"title": "Parasite", "release_date": "2019-05-30", "runtime": 132, "genres": ["drama"]}
+{"title": "Broken", "release_date": "someday"}`
+		var report struct {
+			Import importReport `json:"import"`
+		}
+		s.expect(s.do("post /v1/admin/movies/import", "/v1/admin/movies/import?format=ndjson", ndjson, true), http.StatusUnprocessableEntity, &report)
+		if report.Import.Committed || report.Import.Failed != 1 {
+			t.Errorf("one bad row should stop the import, got %+v", report.Import)
+		}
+
+		//release_date is required like everywhere else
+		s.expect(s.do("post /v1/admin/movies/import", "/v1/admin/movies/import?format=csv", "title,release_date\nUndated,\n", true), http.StatusUnprocessableEntity, &report)
+		if len(report.Import.Rows) != 1 || report.Import.Rows[0].Error != "release_date is required" {
+			t.Errorf("expected a missing release_date, got %+v", report.Import.Rows)
+		}
+
+		//the same checks as the api, so what the api takes can be imported again
+		s.expect(s.do("post /v1/admin/movies/import", "/v1/admin/movies/import?format=csv", "title,release_date,rating\nToo good,2020-01-01,6\n", true), http.StatusUnprocessableEntity, &report)
+		if len(report.Import.Rows) != 1 || report.Import.Rows[0].Error != "rating must be between 0 and 5" {
+			t.Errorf("expected a bad rating, got %+v", report.Import.Rows)
+		}
+
+		ndjson = strings.SplitN(ndjson, "\n", 2)[0]
+		s.expect(s.do("post /v1/admin/movies/import", "/v1/admin/movies/import?format=ndjson", ndjson, true), http.StatusOK, &report)
+		if !report.Import.Committed || report.Import.Created != 1 {
+			t.Errorf("expected one created movie, got %+v", report.Import)
+		}
+
+		w := s.do("get /v1/admin/movies/export", fmt.Sprintf("/v1/admin/movies/export?format=csv&genre_id=%d", drama), "", true)
+		s.expect(w, http.StatusOK, nil)
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		if len(lines) != 3 || !strings.Contains(lines[2], "Parasite") {
+			t.Errorf("expected the two drama movies, got %q", w.Body.String())
+		}
+
+		//a | in a genre name survives the way out and back in
+		odd := s.db.AddGenre(`Sci|Fi \ Fantasy`)
+		ndjson = `{"title": "Brazil", "release_date": "1985-02-20", "genres": ["Sci|Fi \\ Fantasy"]}`
+		s.expect(s.do("post /v1/admin/movies/import", "/v1/admin/movies/import?format=ndjson", ndjson, true), http.StatusOK, &report)
+		w = s.do("get /v1/admin/movies/export", fmt.Sprintf("/v1/admin/movies/export?format=csv&genre_id=%d", odd), "", true)
+		s.expect(w, http.StatusOK, nil)
+		if !strings.Contains(w.Body.String(), `,Sci\|Fi \\ Fantasy`) {
+			t.Fatalf("expected the | escaped, got %q", w.Body.String())
+		}
+		s.expect(s.do("post /v1/admin/movies/import", "/v1/admin/movies/import?format=csv", w.Body.String(), true), http.StatusOK, &report)
+		if report.Import.Updated != 1 {
+			t.Errorf("expected the export to import again, got %+v", report.Import)
+		}
+	})
+}
+
+func TestTrashHandlers(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		joker := s.seedMovies().joker
+
+		path := fmt.Sprintf("/v1/movies/%d", joker.ID)
+		s.expect(s.do("delete /v1/movies/{id}", path, "", false), http.StatusBadRequest, nil)
+		s.expect(s.do("get /v1/admin/deletemovie/{id}", fmt.Sprintf("/v1/admin/deletemovie/%d", joker.ID), "", false), http.StatusBadRequest, nil)
+
+		s.expectOK(s.do("delete /v1/movies/{id}", path, "", true))
+		s.expect(s.do("delete /v1/movies/{id}", path, "", true), http.StatusNotFound, nil)
+		s.expect(s.do("get /v1/admin/deletemovie/{id}", fmt.Sprintf("/v1/admin/deletemovie/%d", joker.ID), "", true), http.StatusNotFound, nil)
+		s.expect(s.do("get /v1/movies/{id}", path, "", false), http.StatusBadRequest, nil)
+
+		//a trashed movie can't be edited until it is restored
+		body := fmt.Sprintf(`{"id": "%d", "title": "Joker", "release_date": "2019-10-04"}`, joker.ID)
+		s.expect(s.do("post /v1/admin/editmovie", "/v1/admin/editmovie", body, true), http.StatusNotFound, nil)
+		s.expect(s.do("put /v1/movies/{id}", path, `{"title": "Joker", "release_date": "2019-10-04"}`, true), http.StatusNotFound, nil)
+		s.expect(s.do("patch /v1/movies/{id}", path, `{"runtime": 1}`, true, "Content-Type", "application/merge-patch+json"), http.StatusNotFound, nil)
+		var img bytes.Buffer
+		png.Encode(&img, image.NewGray(image.Rect(0, 0, 10, 10)))
+		form, contentType := imageForm(img.Bytes())
+		s.expect(s.do("post /v1/admin/movies/{id}/poster", fmt.Sprintf("/v1/admin/movies/%d/poster", joker.ID), form, true, "Content-Type", contentType), http.StatusNotFound, nil)
+
+		var trash struct {
+			Movies []models.Movie `json:"movies"`
+		}
+		s.expect(s.do("get /v1/admin/trash", "/v1/admin/trash", "", true), http.StatusOK, &trash)
+		if len(trash.Movies) != 1 || trash.Movies[0].ID != joker.ID {
+			t.Errorf("expected Joker in the trash, got %+v", trash.Movies)
+		}
+
+		s.expectOK(s.do("post /v1/admin/restoremovie/{id}", fmt.Sprintf("/v1/admin/restoremovie/%d", joker.ID), "", true))
+		s.expect(s.do("post /v1/admin/restoremovie/{id}", fmt.Sprintf("/v1/admin/restoremovie/%d", joker.ID), "", true), http.StatusNotFound, nil)
+		s.expect(s.do("get /v1/movies/{id}", path, "", false), http.StatusOK, nil)
+
+		//the old route still works with a token
+		s.expectOK(s.do("get /v1/admin/deletemovie/{id}", fmt.Sprintf("/v1/admin/deletemovie/%d", joker.ID), "", true))
+		s.expectOK(s.do("post /v1/admin/restoremovie/{id}", fmt.Sprintf("/v1/admin/restoremovie/%d", joker.ID), "", true))
+	})
+}
+
+func TestGraphQL(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		drama := s.seedMovies().drama
+
+		query := `{"query": "{ movies(genreId: %d) { total items { title genres { name } } } me { email } }"}`
+
+		var resp struct {
+			Data struct {
+				Movies struct {
+					Total int `json:"total"`
+					Items []struct {
+						Title  string `json:"title"`
+						Genres []struct {
+							Name string `json:"name"`
+						} `json:"genres"`
+					} `json:"items"`
+				} `json:"movies"`
+				Me struct {
+					Email string `json:"email"`
+				} `json:"me"`
+			} `json:"data"`
+		}
+		s.expect(s.do("post /graphql", "/graphql", fmt.Sprintf(query, drama), true), http.StatusOK, &resp)
+		if resp.Data.Movies.Total != 1 || resp.Data.Movies.Items[0].Genres[0].Name != "Drama" {
+			t.Errorf("unexpected movies %+v", resp.Data.Movies)
+		}
+		if resp.Data.Me.Email != "me@example.com" {
+			t.Errorf("unexpected user %+v", resp.Data.Me)
+		}
+
+		s.expect(s.do("post /graphql", "/graphql", `{"query": "{ genres { name } }"}`, false, "Authorization", "Bearer nope"), http.StatusForbidden, nil)
+
+		//movies are checked like the rest api checks them
+		var created struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		mutation := `{"query": "mutation { createMovie(input: {title: \"Too good\", releaseDate: \"2020-01-01\", rating: 6}) { id } }"}`
+		s.expect(s.do("post /graphql", "/graphql", mutation, true), http.StatusOK, &created)
+		if len(created.Errors) != 1 || created.Errors[0].Message != "rating must be between 0 and 5" {
+			t.Errorf("expected a bad rating, got %+v", created.Errors)
+		}
+
+		//deep and long queries are refused on the public endpoint
+		deep := `{"query": "{ __schema { types { fields { type { ofType { ofType { ofType { ofType { ofType { ofType { name } } } } } } } } } } }"}`
+		s.expect(s.do("post /graphql", "/graphql", deep, false), http.StatusOK, &created)
+		if len(created.Errors) == 0 || !strings.Contains(created.Errors[0].Message, "exceeds max depth") {
+			t.Errorf("expected the depth to be too much, got %+v", created.Errors)
+		}
+		long := fmt.Sprintf(`{"query": "{ genres { name %s} }"}`, strings.Repeat("name ", graphqlMaxLength/5))
+		s.expect(s.do("post /graphql", "/graphql", long, false), http.StatusBadRequest, nil)
+
+		//a movie without a release date has null and not year 1
+		if date := (&movieResolver{movie: &models.Movie{}}).ReleaseDate(); date != nil {
+			t.Errorf("expected no release date, got %q", *date)
+		}
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		joker := s.seedMovies().joker
+		s.expect(s.do("get /v1/movies/{id}", fmt.Sprintf("/v1/movies/%d", joker.ID), "", false), http.StatusOK, nil)
+
+		var metrics struct {
+			Queries map[string]models.QueryStats `json:"queries"`
+		}
+		s.expect(s.do("get /v1/admin/metrics", "/v1/admin/metrics", "", true), http.StatusOK, &metrics)
+
+		//the memory models run no sql
+		if s.backend != "memory" {
+			if got := metrics.Queries["movies.get"]; got.Count == 0 || got.MaxMS <= 0 {
+				t.Errorf("expected movies.get in the metrics, got %+v", metrics.Queries)
+			}
+		}
+	})
+}
+
+func TestDocs(t *testing.T) {
+	handlerTest(t, func(t *testing.T, s *testServer) {
+		s.expect(s.do("get /v1/openapi.json", "/v1/openapi.json", "", false), http.StatusOK, nil)
+		w := s.do("get /v1/docs", "/v1/docs", "", false)
+		s.expect(w, http.StatusOK, nil)
+		//everything the page loads is ours
+		if strings.Contains(w.Body.String(), "https://") {
+			t.Errorf("the docs page loads files from elsewhere:\n%s", w.Body.String())
+		}
+
+		//swagger ui itself is only there after go generate
+		if _, err := docs.ReadFile("docs/swagger-ui/swagger-ui-bundle.js"); err == nil {
+			w = s.do("get /v1/docs/{file}", "/v1/docs/swagger-ui-bundle.js", "", false)
+			s.expect(w, http.StatusOK, nil)
+			if !strings.Contains(w.Header().Get("Content-Type"), "javascript") {
+				t.Errorf("expected javascript, got %q", w.Header().Get("Content-Type"))
+			}
+		}
+		s.expect(s.do("get /v1/docs/{file}", "/v1/docs/nothing.js", "", false), http.StatusNotFound, nil)
+	})
+}
+
+//TestRoutesCovered checks that the handler tests above sent a request to every route in routes().
+//It has to come after them, so it only checks when the whole package runs in order and nothing failed
+func TestRoutesCovered(t *testing.T) {
+	if f := flag.Lookup("test.run"); f != nil && f.Value.String() != "" {
+		t.Skip("some handler tests may have been left out with -run")
+	}
+	if f := flag.Lookup("test.shuffle"); f != nil && f.Value.String() != "off" {
+		t.Skip("with -shuffle the handler tests may not have run yet")
+	}
+	if handlerTestFailed {
+		t.Skip("a handler test failed before it got to all of its routes")
+	}
+
+	for _, route := range registeredRoutes(t) {
+		if !coveredRoutes[route] {
+			t.Errorf("%s has no handler test", route)
+		}
+	}
+}
+
+//imageForm is a multipart form with data in its image field, like the upload endpoints take
+func imageForm(data []byte) (string, string) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("image", "poster.png")
+	part.Write(data)
+	mw.Close()
+	return body.String(), mw.FormDataContentType()
+}
+
+//failingBlobs is a BlobStore that can't store more than a few blobs
+type failingBlobs struct {
+	storage.BlobStore
+	puts int
+}
+
+func (b *failingBlobs) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if b.puts == 0 {
+		return errors.New("disk full")
+	}
+	b.puts--
+	return b.BlobStore.Put(ctx, key, r, contentType)
+}
+
+//TestImageStorageFails checks that a store going wrong is a server error and leaves no files behind
+func TestImageStorageFails(t *testing.T) {
+	dir := t.TempDir()
+	files, err := storage.NewFileStore(dir, "http://localhost:8080/v1/images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{logger: log.New(io.Discard, "", 0), blobs: &failingBlobs{BlobStore: files, puts: 2}}
+	app.config.storage.maxUpload = 1 << 20
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 600, 900)))
+	body, contentType := imageForm(img.Bytes())
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/admin/movies/1/poster", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: "1"}}))
+	w := httptest.NewRecorder()
+	app.uploadMovieImage("poster")(w, r)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "disk full") {
+		t.Errorf("expected a 500 without the details, got %d: %s", w.Code, w.Body.String())
+	}
+
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			t.Errorf("%s should have been removed", path)
+		}
+		return nil
+	})
+}
+
+//TestKeepWriting checks that a streamed response can take longer than -write-timeout as long as it keeps going,
+//while everything else is still cut off
+func TestKeepWriting(t *testing.T) {
+	app := &application{logger: log.New(io.Discard, "", 0)}
+	app.config.writeTimeout = 100 * time.Millisecond
+
+	chunk := bytes.Repeat([]byte("x"), 64<<10)
+	stream := func(keep bool) http.Handler {
+		return app.writeDeadline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			out := io.Writer(w)
+			if keep {
+				out = app.keepWriting(w, r)
+			}
+			for i := 0; i < 5; i++ {
+				time.Sleep(40 * time.Millisecond)
+				if _, err := out.Write(chunk); err != nil {
+					return
+				}
+			}
+		}))
+	}
+
+	for _, keep := range []bool{true, false} {
+		srv := httptest.NewUnstartedServer(stream(keep))
+		srv.Config.ConnContext = saveConn
+		srv.Start()
+
+		resp, err := http.Get(srv.URL)
+		var n int64
+		if err == nil {
+			n, err = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		srv.Close()
+
+		complete := err == nil && n == int64(5*len(chunk))
+		if complete != keep {
+			t.Errorf("keepWriting %v: got %d bytes, err %v", keep, n, err)
+		}
+	}
+}
+
+//TestCompressAbort checks that a handler aborting halfway, like a failed export, leaves the compressed body cut off
+//instead of finishing it into something that looks complete
+func TestCompressAbort(t *testing.T) {
+	app := &application{}
+	app.config.compress.minSize = 256
+
+	handler := app.compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write(bytes.Repeat([]byte(`{"title": "The Batman"}`+"\n"), 1000))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/admin/movies/export", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if recover() != http.ErrAbortHandler {
+				t.Error("expected the panic to go on to net/http")
+			}
+		}()
+		handler.ServeHTTP(w, r)
+	}()
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(io.Discard, zr)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected a cut off gzip stream, got %v", err)
+	}
+}
+
+//TestQueriesStopWithTheRequest checks that the request context reaches the database,
+//so a client that went away doesn't leave its queries running
+func TestQueriesStopWithTheRequest(t *testing.T) {
+	s := newTestServer(t, "sqlite")
+	s.db.AddGenre("Drama")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/genres", nil).WithContext(ctx))
+	if w.Code == http.StatusOK || !strings.Contains(w.Body.String(), context.Canceled.Error()) {
+		t.Errorf("expected the query to be cancelled, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//defaultCacheControl is the Cache-Control of the read endpoints, by route like in routes().-cache-control changes them
+var defaultCacheControl = map[string]string{
+	"/v1/movies":           "public, max-age=60",
+	"/v1/movies/:id":       "public, max-age=60",
+	"/v1/genres":           "public, max-age=300",
+	"/v1/genres/:genre_id": "public, max-age=60",
+}
+
+//cacheControlFlag is the -cache-control flag, route=policy and given once for every route to change
+type cacheControlFlag map[string]string
+
+func (f cacheControlFlag) String() string {
+	var parts []string
+	for route, policy := range f {
+		parts = append(parts, route+"="+policy)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f cacheControlFlag) Set(value string) error {
+	route, policy, ok := strings.Cut(value, "=")
+	if !ok || !strings.HasPrefix(route, "/") {
+		return fmt.Errorf("want route=policy, like /v1/movies=no-cache, got %q", value)
+	}
+	f[route] = policy
+	return nil
+}
+
+//bufferedResponse holds on to what the handler writes so conditionalGET can look at the whole body first
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+//conditionalGET gives the successful responses of route a strong ETag from their content and the route's Cache-Control.
+//A client sending back the ETag in If-None-Match, or the Last-Modified the handler set in If-Modified-Since, gets
+//304 Not Modified without the body.If-Modified-Since only counts without If-None-Match, the ETag is the better check.
+//Range requests get the whole body, a slice of a json document is no use to anyone
+func (app *application) conditionalGET(route string, next http.Handler) http.Handler {
+	policy, ok := app.config.cacheControl[route]
+	if !ok {
+		policy = "no-cache"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := &bufferedResponse{ResponseWriter: w}
+		next.ServeHTTP(buf, r)
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(buf.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		//compress weakens the ETag of what it compresses.It is done here already so the 304 has the ETag the 200 would have
+		if cw, ok := w.(*compressWriter); ok && cw.compresses(w.Header().Get("Content-Type"), buf.body.Bytes()) {
+			etag = "W/" + etag
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", policy)
+
+		notModified := etagMatches(r.Header.Get("If-None-Match"), etag)
+		if r.Header.Get("If-None-Match") == "" {
+			notModified = notModifiedSince(r.Header.Get("If-Modified-Since"), w.Header().Get("Last-Modified"))
+		}
+		if notModified {
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(buf.body.Len()))
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.body.Bytes())
+	})
+}
+
+//etagMatches checks an If-None-Match header against etag.It compares weakly like If-None-Match should, so the
+//W/ compress puts on the ETag of a compressed response still matches
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+//notModifiedSince checks an If-Modified-Since header against the Last-Modified of the response.Both are
+//whole seconds, see setLastModified
+func notModifiedSince(ifModifiedSince, lastModified string) bool {
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+//setLastModified sends modified as Last-Modified.updated_at moves with everything the movie responses show,
+//the reviews and credits too, see touchMovie in the models
+func setLastModified(w http.ResponseWriter, modified time.Time) {
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
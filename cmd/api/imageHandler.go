@@ -0,0 +1,90 @@
+package main
+
+import (
+	"backend/models"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//uploadMovieImage returns the handler for uploading a poster or a backdrop.The image comes in the "image" field of a multipart form
+func (app *application) uploadMovieImage(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		id, err := strconv.Atoi(params.ByName("id"))
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+
+		//anything bigger than the limit is cut off and the form fails to parse
+		r.Body = http.MaxBytesReader(w, r.Body, app.config.storage.maxUpload+1024*1024)
+		err = r.ParseMultipartForm(app.config.storage.maxUpload)
+		if err != nil {
+			app.errorResponse(w, r, fmt.Errorf("the upload is not a valid form or is bigger than %d bytes", app.config.storage.maxUpload), http.StatusRequestEntityTooLarge)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			app.errorResponse(w, r, errors.New("the image field is missing"))
+			return
+		}
+		defer file.Close()
+
+		if header.Size > app.config.storage.maxUpload {
+			app.errorResponse(w, r, fmt.Errorf("the image is bigger than %d bytes", app.config.storage.maxUpload), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+
+		key, err := app.storeImage(r.Context(), id, kind, data)
+		if errors.Is(err, errBadImage) {
+			app.errorResponse(w, r, err, http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			app.logger.Println("storing an image failed:", err)
+			app.errorResponse(w, r, errors.New("the image could not be stored"), http.StatusInternalServerError)
+			return
+		}
+
+		old, err := app.models.Movies.SetMovieImage(r.Context(), id, kind, key)
+		if err != nil {
+			//the movie isn't there so the files we just stored aren't needed
+			app.deleteImage(r.Context(), kind, key)
+
+			if errors.Is(err, models.ErrNotFound) {
+				app.errorResponse(w, r, errors.New("movie not found"), http.StatusNotFound)
+				return
+			}
+			app.errorResponse(w, r, err)
+			return
+		}
+
+		//the previous image isn't used anymore.If removing it fails it is only wasted space so we just log it
+		if old != "" {
+			err = app.deleteImage(r.Context(), kind, old)
+			if err != nil {
+				app.logger.Println(err)
+			}
+		}
+
+		err = app.writeResponse(w, r, http.StatusOK, app.imageURLs(kind, key), kind)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"backend/models"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"path"
+
+	//registers the png decoder for image.Decode
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	//registers the webp decoder for image.Decode
+	_ "golang.org/x/image/webp"
+)
+
+//thumbnail widths we make for every upload.The original is kept as well
+var imageWidths = map[string][]int{
+	"poster":   {92, 185, 342, 500},
+	"backdrop": {300, 780, 1280},
+}
+
+//image types we accept and the file extension we store them with
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+//maxImageSide is the widest and tallest image we take.A small file can claim to be huge and decoding it would
+//take all the memory, so the size is checked before decoding
+const maxImageSide = 6000
+
+//errBadImage is returned by decodeImage for uploads that aren't an image we can take.Everything else going wrong
+//while storing an image is our problem and not the client's
+var errBadImage = errors.New("bad image")
+
+//decodeImage checks what the upload really is from its first bytes, we don't trust the filename or the header the client sent
+func decodeImage(data []byte) (image.Image, string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := imageTypes[contentType]; !ok {
+		return nil, "", fmt.Errorf("%w: unsupported image type %s, use jpeg, png or webp", errBadImage, contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: the image could not be read", errBadImage)
+	}
+	if config.Width > maxImageSide || config.Height > maxImageSide {
+		return nil, "", fmt.Errorf("%w: the image is %dx%d, it can be at most %dx%d", errBadImage, config.Width, config.Height, maxImageSide, maxImageSide)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: the image could not be read", errBadImage)
+	}
+
+	return img, contentType, nil
+}
+
+//resize scales img down to width keeping its aspect ratio.Images that are smaller already are never scaled up
+func resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		width = bounds.Dx()
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+//storeImage saves the original and all its thumbnails and returns the key of the original.
+//Every upload gets its own random folder so browsers and CDNs never show an old cached image.
+//When one of them can't be stored the ones stored already are deleted again
+func (app *application) storeImage(ctx context.Context, movieID int, kind string, data []byte) (_ string, err error) {
+	img, contentType, err := decodeImage(data)
+	if err != nil {
+		return "", err
+	}
+
+	random := make([]byte, 8)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	dir := fmt.Sprintf("%ss/%d/%s", kind, movieID, hex.EncodeToString(random))
+
+	key := dir + "/original" + imageTypes[contentType]
+	defer func() {
+		if err != nil {
+			//Delete doesn't mind the sizes we didn't get to
+			if cleanupErr := app.deleteImage(ctx, kind, key); cleanupErr != nil {
+				app.logger.Println("can't remove the image left over from a failed upload:", cleanupErr)
+			}
+		}
+	}()
+
+	err = app.blobs.Put(ctx, key, bytes.NewReader(data), contentType)
+	if err != nil {
+		return "", err
+	}
+
+	for _, width := range imageWidths[kind] {
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, resize(img, width), &jpeg.Options{Quality: 85})
+		if err != nil {
+			return "", err
+		}
+
+		err = app.blobs.Put(ctx, fmt.Sprintf("%s/w%d.jpg", dir, width), &buf, "image/jpeg")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return key, nil
+}
+
+//deleteImage removes an original and its thumbnails
+func (app *application) deleteImage(ctx context.Context, kind, key string) error {
+	err := app.blobs.Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	for _, width := range imageWidths[kind] {
+		err = app.blobs.Delete(ctx, fmt.Sprintf("%s/w%d.jpg", path.Dir(key), width))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//imageURLs turns the key of an original into the urls of all its sizes
+func (app *application) imageURLs(kind, key string) map[string]string {
+	if key == "" || app.blobs == nil {
+		return nil
+	}
+
+	urls := map[string]string{
+		"original": app.blobs.URL(key),
+	}
+	for _, width := range imageWidths[kind] {
+		size := fmt.Sprintf("w%d", width)
+		urls[size] = app.blobs.URL(path.Dir(key) + "/" + size + ".jpg")
+	}
+	return urls
+}
+
+//attachImages fills in the poster and backdrop urls before movies are sent to the client
+func (app *application) attachImages(movies ...*models.Movie) {
+	for _, movie := range movies {
+		movie.Poster = app.imageURLs("poster", movie.PosterKey)
+		movie.Backdrop = app.imageURLs("backdrop", movie.BackdropKey)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"backend/models"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//movieRecord is one movie in an import or export file.In NDJSON it is one object per line, in CSV the header names the columns.
+//Genres are genre names, separated by | in CSV, see joinGenres.Exports use the same format so they can be imported again
+type movieRecord struct {
+	ID          int      `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	ReleaseDate string   `json:"release_date"`
+	Runtime     int      `json:"runtime"`
+	Rating      int      `json:"rating"`
+	MPAARating  string   `json:"mpaa_rating"`
+	Genres      []string `json:"genres"`
+}
+
+//importReport is what we send back after an import
+type importReport struct {
+	DryRun    bool                  `json:"dry_run"`
+	Committed bool                  `json:"committed"`
+	Created   int                   `json:"created"`
+	Updated   int                   `json:"updated"`
+	Failed    int                   `json:"failed"`
+	Rows      []models.ImportResult `json:"rows"`
+}
+
+var genreEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`)
+
+//joinGenres puts genre names in one CSV cell separated by |.A | or \ in a name gets a \ in front
+func joinGenres(genres []string) string {
+	escaped := make([]string, len(genres))
+	for i, g := range genres {
+		escaped[i] = genreEscaper.Replace(g)
+	}
+	return strings.Join(escaped, "|")
+}
+
+//splitGenres reads a cell written by joinGenres
+func splitGenres(cell string) []string {
+	var genres []string
+	var g strings.Builder
+	for i := 0; i < len(cell); i++ {
+		switch {
+		case cell[i] == '\\' && i+1 < len(cell):
+			i++
+			g.WriteByte(cell[i])
+		case cell[i] == '|':
+			genres = append(genres, g.String())
+			g.Reset()
+		default:
+			g.WriteByte(cell[i])
+		}
+	}
+	return append(genres, g.String())
+}
+
+//csvColumns are the columns an import CSV can have.title and release_date are required, like when a movie is saved through the api
+var csvColumns = map[string]bool{
+	"id": true, "title": true, "description": true, "release_date": true,
+	"runtime": true, "rating": true, "mpaa_rating": true, "genres": true,
+}
+
+//toImportRow checks a record and turns it into a models.ImportRow.The fields are checked by MoviePayload.validate,
+//the same way the api checks them, so whatever can be saved there can be exported and imported again
+func (rec movieRecord) toImportRow(line int) models.ImportRow {
+	row := models.ImportRow{Row: line, Genres: rec.Genres}
+
+	if rec.ID < 0 {
+		row.Err = errors.New("id can't be negative")
+		return row
+	}
+
+	payload := MoviePayload{
+		Title:       rec.Title,
+		Description: rec.Description,
+		Runtime:     FlexInt(rec.Runtime),
+		Rating:      FlexInt(rec.Rating),
+		MPAARating:  rec.MPAARating,
+	}
+	//an empty release_date is left zero so validate says it is required
+	if strings.TrimSpace(rec.ReleaseDate) != "" {
+		releaseDate, err := time.Parse("2006-01-02", rec.ReleaseDate)
+		if err != nil {
+			row.Err = errors.New("release_date must look like 2006-01-02")
+			return row
+		}
+		payload.ReleaseDate = models.NewDate(releaseDate)
+	}
+
+	err := payload.validate()
+	if err != nil {
+		row.Err = err
+		return row
+	}
+
+	row.Movie.ID = rec.ID
+	row.Movie.Title = strings.TrimSpace(payload.Title)
+	row.Movie.Description = payload.Description
+	row.Movie.ReleaseDate = payload.ReleaseDate
+	row.Movie.Year = payload.ReleaseDate.Year()
+	row.Movie.Runtime = int(payload.Runtime)
+	row.Movie.Rating = int(payload.Rating)
+	row.Movie.MPAARating = payload.MPAARating
+	row.Movie.Created_At = time.Now()
+	row.Movie.Updated_At = time.Now()
+	return row
+}
+
+//readImport reads a CSV or NDJSON import.Rows that can't be read get an error on them, only a broken file as a whole returns an error
+func readImport(r io.Reader, format string) ([]models.ImportRow, error) {
+	switch format {
+	case "csv":
+		return readImportCSV(r)
+	case "ndjson":
+		return readImportNDJSON(r)
+	default:
+		return nil, fmt.Errorf("unknown import format %q, use csv or ndjson", format)
+	}
+}
+
+func readImportCSV(r io.Reader) ([]models.ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !csvColumns[name] {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, errors.New("the title column is required")
+	}
+
+	var rows []models.ImportRow
+	//line 1 is the header
+	line := 1
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			//a broken line doesn't stop the rest of the file from being read
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, models.ImportRow{Row: line, Err: parseErr.Err})
+				continue
+			}
+			return nil, err
+		}
+
+		get := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(fields) {
+				return ""
+			}
+			return strings.TrimSpace(fields[i])
+		}
+
+		var rec movieRecord
+		var convErr error
+		number := func(name string) int {
+			v := get(name)
+			if v == "" || convErr != nil {
+				return 0
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				convErr = fmt.Errorf("%s must be a whole number", name)
+			}
+			return n
+		}
+
+		rec.ID = number("id")
+		rec.Title = get("title")
+		rec.Description = get("description")
+		rec.ReleaseDate = get("release_date")
+		rec.Runtime = number("runtime")
+		rec.Rating = number("rating")
+		rec.MPAARating = get("mpaa_rating")
+		if _, ok := columns["genres"]; ok {
+			rec.Genres = []string{}
+			for _, g := range splitGenres(get("genres")) {
+				if g = strings.TrimSpace(g); g != "" {
+					rec.Genres = append(rec.Genres, g)
+				}
+			}
+		}
+
+		if convErr != nil {
+			rows = append(rows, models.ImportRow{Row: line, Movie: models.Movie{Title: rec.Title}, Err: convErr})
+			continue
+		}
+		rows = append(rows, rec.toImportRow(line))
+	}
+
+	return rows, nil
+}
+
+func readImportNDJSON(r io.Reader) ([]models.ImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	//one line is one movie but descriptions can be long
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []models.ImportRow
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var rec movieRecord
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&rec)
+		if err != nil {
+			rows = append(rows, models.ImportRow{Row: line, Err: fmt.Errorf("invalid json: %v", err)})
+			continue
+		}
+
+		rows = append(rows, rec.toImportRow(line))
+	}
+
+	return rows, scanner.Err()
+}
+
+//importMovies reads an import and saves it, returning the report
+func (app *application) importMovies(ctx context.Context, r io.Reader, format string, dryRun bool) (*importReport, error) {
+	rows, err := readImport(r, format)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("there are no movies in the file")
+	}
+
+	results, committed, err := app.models.Movies.ImportMovies(ctx, rows, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	report := importReport{
+		DryRun:    dryRun,
+		Committed: committed,
+		Rows:      results,
+	}
+	for _, result := range results {
+		switch result.Status {
+		case models.ImportCreated:
+			report.Created++
+		case models.ImportUpdated:
+			report.Updated++
+		case models.ImportFailed:
+			report.Failed++
+		}
+	}
+
+	return &report, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+//biggest import we take over http.The CLI has no limit
+const maxImportSize = 50 << 20
+
+//imports movies from a CSV or NDJSON body.?dry_run=true checks everything without saving
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = "csv"
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			format = "ndjson"
+		default:
+			app.errorResponse(w, r, errors.New("send text/csv or application/x-ndjson, or set ?format="), http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			app.errorResponse(w, r, errors.New("dry_run must be true or false"))
+			return
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	report, err := app.importMovies(r.Context(), r.Body, format, dryRun)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	//when a row failed nothing was saved
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	err = app.writeResponse(w, r, status, report, "import")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
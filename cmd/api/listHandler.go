@@ -0,0 +1,291 @@
+package main
+
+import (
+	"backend/models"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//ListPayload is what we get when a user creates or edits a list
+type ListPayload struct {
+	Name   string `json:"name"`
+	Public bool   `json:"public"`
+}
+
+//ListMoviePayload is for adding a movie to a list
+type ListMoviePayload struct {
+	MovieID int `json:"movie_id"`
+}
+
+//ListOrderPayload holds every movie a list shows in the new order, the ones in the trash aren't shown or needed
+type ListOrderPayload struct {
+	MovieIDs []int `json:"movie_ids"`
+}
+
+//ownList gets the list from the :id url parameter and makes sure it belongs to the signed in user.
+//If it doesn't the error response is already written and nil is returned
+func (app *application) ownList(w http.ResponseWriter, r *http.Request) *models.List {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return nil
+	}
+
+	list, err := app.models.Lists.GetList(r.Context(), id)
+	//someone else's list looks the same as one that doesn't exist
+	if errors.Is(err, models.ErrNotFound) || (err == nil && list.UserID != app.userID(r)) {
+		app.errorResponse(w, r, errors.New("list not found"), http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return nil
+	}
+
+	return list
+}
+
+//all lists of the signed in user
+func (app *application) getMyLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := app.models.Lists.UserLists(r.Context(), app.userID(r))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, lists, "lists")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
+
+//one list of the signed in user with its movies
+func (app *application) getMyList(w http.ResponseWriter, r *http.Request) {
+	list := app.ownList(w, r)
+	if list == nil {
+		return
+	}
+	app.attachImages(list.Movies...)
+
+	err := app.writeResponse(w, r, http.StatusOK, list, "list")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
+
+//a public list anyone can see with its slug
+func (app *application) getSharedList(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	list, err := app.models.Lists.ListBySlug(r.Context(), params.ByName("slug"))
+	if errors.Is(err, models.ErrNotFound) || (err == nil && !list.Public) {
+		app.errorResponse(w, r, errors.New("list not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.attachImages(list.Movies...)
+
+	err = app.writeResponse(w, r, http.StatusOK, list, "list")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
+
+//creates a new list for the signed in user
+func (app *application) createList(w http.ResponseWriter, r *http.Request) {
+	var payload ListPayload
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		app.errorResponse(w, r, errors.New("name is required"))
+		return
+	}
+
+	list := models.List{
+		UserID:     app.userID(r),
+		Name:       payload.Name,
+		Public:     payload.Public,
+		Created_At: time.Now(),
+		Updated_At: time.Now(),
+	}
+
+	id, err := app.models.Lists.InsertList(r.Context(), list)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	created, err := app.models.Lists.GetList(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusCreated, created, "list")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
+
+//renames a list or changes whether it is public
+func (app *application) updateList(w http.ResponseWriter, r *http.Request) {
+	list := app.ownList(w, r)
+	if list == nil {
+		return
+	}
+
+	var payload ListPayload
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		app.errorResponse(w, r, errors.New("name is required"))
+		return
+	}
+
+	list.Name = payload.Name
+	list.Public = payload.Public
+	list.Updated_At = time.Now()
+
+	err = app.models.Lists.UpdateList(r.Context(), *list)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
+
+//deletes one of the user's lists.The favourites list can't be deleted
+func (app *application) deleteList(w http.ResponseWriter, r *http.Request) {
+	list := app.ownList(w, r)
+	if list == nil {
+		return
+	}
+
+	if list.Default {
+		app.errorResponse(w, r, errors.New("the favourites list can't be deleted"))
+		return
+	}
+
+	err := app.models.Lists.DeleteList(r.Context(), list.ID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
+
+//adds a movie to the end of a list
+func (app *application) addListMovie(w http.ResponseWriter, r *http.Request) {
+	list := app.ownList(w, r)
+	if list == nil {
+		return
+	}
+
+	var payload ListMoviePayload
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	_, err = app.models.Movies.Get(r.Context(), payload.MovieID)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorResponse(w, r, errors.New("movie not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Lists.AddListMovie(r.Context(), list.ID, payload.MovieID)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
+
+//takes a movie out of a list
+func (app *application) removeListMovie(w http.ResponseWriter, r *http.Request) {
+	list := app.ownList(w, r)
+	if list == nil {
+		return
+	}
+
+	params := httprouter.ParamsFromContext(r.Context())
+
+	movieID, err := strconv.Atoi(params.ByName("movie_id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Lists.RemoveListMovie(r.Context(), list.ID, movieID)
+	if errors.Is(err, models.ErrNotFound) {
+		app.errorResponse(w, r, errors.New("movie is not in the list"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
+
+//puts the movies of a list in a new order
+func (app *application) reorderList(w http.ResponseWriter, r *http.Request) {
+	list := app.ownList(w, r)
+	if list == nil {
+		return
+	}
+
+	var payload ListOrderPayload
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Lists.ReorderList(r.Context(), list.ID, payload.MovieIDs)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
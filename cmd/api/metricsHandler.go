@@ -0,0 +1,14 @@
+package main
+
+import (
+	"net/http"
+)
+
+//shows how often every database query ran and how long it took since the server started
+func (app *application) getMetrics(w http.ResponseWriter, r *http.Request) {
+	err := app.writeResponse(w, r, http.StatusOK, app.queryMetrics.Snapshot(), "queries")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"backend/models"
+	"context"
 	"errors"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,6 +15,54 @@ import (
 	"github.com/pascaldekloe/jwt"
 )
 
+//contextKey is used for our own values in the request context so they can't clash with other packages
+type contextKey string
+
+//userIDKey holds the id of the signed in user.checkToken puts it in the context
+const userIDKey contextKey = "userID"
+
+//connKey holds the connection a request came in on, see saveConn
+const connKey contextKey = "conn"
+
+//saveConn is the server's ConnContext.It keeps the connection in the context so writeDeadline can set its write deadline
+func saveConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey, conn)
+}
+
+//writeDeadline gives every response -write-timeout to be written, which is what http.Server.WriteTimeout does.
+//We do it ourselves so handlers streaming something big, like the export, can move the deadline with keepWriting.
+//http.ResponseController can do that too but it needs a newer go than go.mod allows
+func (app *application) writeDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, ok := r.Context().Value(connKey).(net.Conn); ok && app.config.writeTimeout > 0 {
+			conn.SetWriteDeadline(time.Now().Add(app.config.writeTimeout))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//deadlineWriter moves the write deadline of conn on every write
+type deadlineWriter struct {
+	w       io.Writer
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (d deadlineWriter) Write(p []byte) (int, error) {
+	d.conn.SetWriteDeadline(time.Now().Add(d.timeout))
+	return d.w.Write(p)
+}
+
+//keepWriting returns w with a write deadline that moves along with the writes, so a response only runs out of time
+//when the client stops reading for -write-timeout and not when it is simply big
+func (app *application) keepWriting(w io.Writer, r *http.Request) io.Writer {
+	conn, ok := r.Context().Value(connKey).(net.Conn)
+	if !ok || app.config.writeTimeout <= 0 {
+		return w
+	}
+	return deadlineWriter{w: w, conn: conn, timeout: app.config.writeTimeout}
+}
+
 //that how all middlewares are used to prevent cors error
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -18,11 +70,39 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		//modifying header so we can allow certain things to be passed
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization")
+		//browsers ask before sending anything other than GET and POST
+		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
 		next.ServeHTTP(w, r)
 	})
 }
 
 
+//downloads don't use the response envelope so the Accept header isn't ours to check there
+var rawResponsePaths = []string{"/v1/images/", "/v1/admin/movies/export", "/graphql", "/v1/openapi.json", "/v1/docs"}
+
+//negotiate answers 406 Not Acceptable before the handler runs when the client accepts none of the formats writeResponse can send
+func (app *application) negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range rawResponsePaths {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if _, ok := negotiate(r.Header.Get("Accept")); !ok {
+			//the client can't read any of our formats, so the message goes out as plain text
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Add("Vary", "Accept")
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write([]byte("not acceptable, use application/json, application/xml or application/msgpack\n"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 //this middleware will check for valid jwt tokens
 func (app *application) checkToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -37,52 +117,82 @@ func (app *application) checkToken(next http.Handler) http.Handler {
 			// could set an anonymous user
 		}
 
-		//taking headerParts variable and splitting it into spaces.And we will get 2 parts from this split.
-		headerParts := strings.Split(authHeader, " ")
-		//Now we check the header
-		if len(headerParts) != 2 {
-			app.errorJSON(w, errors.New("invalid auth header"))
-			return
-		}
-
-		if headerParts[0] != "Bearer" {
-			app.errorJSON(w, errors.New("unauthorized - no bearer"))
-			return
-		}
-
-		//Now we start checking the token itself
-		token := headerParts[1]
-
-		claims, err := jwt.HMACCheck([]byte(token), []byte(app.config.jwt.secret))
+		userID, status, err := app.validateToken(authHeader)
 		if err != nil {
-			// http.StatusForbidden returns 403 (Forbidden) Status Code in HTTP response 
-			app.errorJSON(w, errors.New("unauthorized - failed hmac check"),http.StatusForbidden)
+			app.errorResponse(w, r, err, status)
 			return
 		}
 
-		if !claims.Valid(time.Now()) {
-			app.errorJSON(w, errors.New("unauthorized - token expired"),http.StatusForbidden)
-			return
-		}
+		log.Println("Valid user:", userID)
 
-		if !claims.AcceptAudience("mydomain.com") {
-			app.errorJSON(w, errors.New("unauthorized - invalid audience"),http.StatusForbidden)
-			return
-		}
+		//handlers behind this middleware can get the user with app.userID(r)
+		ctx := context.WithValue(r.Context(), userIDKey, userID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		if claims.Issuer != "mydomain.com" {
-			app.errorJSON(w, errors.New("unauthorized - invalid issuer"),http.StatusForbidden)
+//requireAdmin lets only admin users through.It goes after checkToken, which gives it the signed in user
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := app.models.Users.GetUser(r.Context(), app.userID(r))
+		if errors.Is(err, models.ErrNotFound) || (err == nil && !user.Admin) {
+			app.errorResponse(w, r, errors.New("admin only"), http.StatusForbidden)
 			return
 		}
-
-		userID, err := strconv.ParseInt(claims.Subject, 10, 64)
 		if err != nil {
-			app.errorJSON(w, errors.New("unauthorized"),http.StatusForbidden)
+			app.errorResponse(w, r, err, http.StatusInternalServerError)
 			return
 		}
-
-		log.Println("Valid user:", userID)
-
 		next.ServeHTTP(w, r)
 	})
 }
+
+//validateToken checks the Authorization header and returns the id of the user in the token.
+//When the token is no good it returns the error and the status code to answer with.
+//checkToken uses it and so does everything else that needs a signed in user, like the graphql endpoint
+func (app *application) validateToken(authHeader string) (int, int, error) {
+	//taking headerParts variable and splitting it into spaces.And we will get 2 parts from this split.
+	headerParts := strings.Split(authHeader, " ")
+	//Now we check the header
+	if len(headerParts) != 2 {
+		return 0, http.StatusBadRequest, errors.New("invalid auth header")
+	}
+
+	if headerParts[0] != "Bearer" {
+		return 0, http.StatusBadRequest, errors.New("unauthorized - no bearer")
+	}
+
+	//Now we start checking the token itself
+	token := headerParts[1]
+
+	claims, err := jwt.HMACCheck([]byte(token), []byte(app.config.jwt.secret))
+	if err != nil {
+		// http.StatusForbidden returns 403 (Forbidden) Status Code in HTTP response 
+		return 0, http.StatusForbidden, errors.New("unauthorized - failed hmac check")
+	}
+
+	if !claims.Valid(time.Now()) {
+		return 0, http.StatusForbidden, errors.New("unauthorized - token expired")
+	}
+
+	if !claims.AcceptAudience("mydomain.com") {
+		return 0, http.StatusForbidden, errors.New("unauthorized - invalid audience")
+	}
+
+	if claims.Issuer != "mydomain.com" {
+		return 0, http.StatusForbidden, errors.New("unauthorized - invalid issuer")
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, http.StatusForbidden, errors.New("unauthorized")
+	}
+
+	return int(userID), http.StatusOK, nil
+}
+
+//userID returns the id of the user checkToken let through.It is 0 on routes that aren't secured
+func (app *application) userID(r *http.Request) int {
+	id, _ := r.Context().Value(userIDKey).(int)
+	return id
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"backend/models"
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -15,7 +20,7 @@ import (
 //jsonResp is used for getting request or response status
 type jsonResp struct {
 	OK      bool   `json:"ok"`
-	Message string `json:message`
+	Message string `json:"message"`
 }
 
 func (app *application) getOneMovie(w http.ResponseWriter, r *http.Request) {
@@ -29,8 +34,8 @@ func (app *application) getOneMovie(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		//prints parameter error in terminal
 		app.logger.Print(errors.New("invalid id parameter"))
-		//sends param to errorJSON func in utilities for better error handling
-		app.errorJSON(w, err)
+		//sends param to errorResponse func in utilities for better error handling
+		app.errorResponse(w, r, err)
 		//breaks out from condition and not the function
 		return
 	}
@@ -39,7 +44,13 @@ func (app *application) getOneMovie(w http.ResponseWriter, r *http.Request) {
 	// app.logger.Println("id is", id)
 
 	//grab data from database from get function in models
-	movie, err := app.models.DB.Get(id)
+	movie, err := app.models.Movies.Get(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.attachImages(movie)
+	setLastModified(w, movie.Updated_At)
 
 	//dummy movie struct data
 	// movie := models.Movie{
@@ -55,44 +66,53 @@ func (app *application) getOneMovie(w http.ResponseWriter, r *http.Request) {
 	// 	Updated_At:  time.Now(),
 	// }
 
-	//sends data to writeJSON func in utilities and it return json with a key
-	err = app.writeJSON(w, http.StatusOK, movie, "movie")
+	//sends data to writeResponse func in utilities and it returns the data with a key
+	err = app.writeResponse(w, r, http.StatusOK, movie, "movie")
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorResponse(w, r, err)
 		return
 	}
 }
 
 func (app *application) getAllMovies(w http.ResponseWriter, r *http.Request) {
+	//asked before the movies, so a write in between makes the date too old and not too new
+	modified, err := app.models.Movies.LastModified(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
 	//getting all the movies.
-	movies, err := app.models.DB.All()
+	movies, err := app.models.Movies.All(r.Context())
 
 	//checking for error
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorResponse(w, r, err)
 		return
 	}
+	app.attachImages(movies...)
+	setLastModified(w, modified)
 
-	//finally pass the movies data to browser by using writeJSON function in utilities
-	err = app.writeJSON(w, http.StatusOK, movies, "movies")
+	//finally pass the movies data to browser by using writeResponse function in utilities
+	err = app.writeResponse(w, r, http.StatusOK, movies, "movies")
 
 	//checking for error
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorResponse(w, r, err)
 		return
 	}
 }
 
 //for getting all genres
 func (app *application) getAllGenres(w http.ResponseWriter, r *http.Request) {
-	genres, err := app.models.DB.GenreAll()
+	genres, err := app.models.Genres.GenreAll(r.Context())
 
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, genres, "genres")
+	err = app.writeResponse(w, r, http.StatusOK, genres, "genres")
 }
 
 //get all movies sorted by genre
@@ -103,21 +123,30 @@ func (app *application) getAllMoviesByGenre(w http.ResponseWriter, r *http.Reque
 	//convert url param to int
 	genreID, err := strconv.Atoi(params.ByName("genre_id"))
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	//a movie leaving the genre only touches itself, so this is the date of all movies like in getAllMovies
+	modified, err := app.models.Movies.LastModified(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	//finally calling All() function with genre id for getting movies with same genre
-	movies, err := app.models.DB.All(genreID)
+	movies, err := app.models.Movies.All(r.Context(), genreID)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorResponse(w, r, err)
 		return
 	}
+	app.attachImages(movies...)
+	setLastModified(w, modified)
 
-	//then passing all the data to writeJSON func in utilities for showing them in browser
-	err = app.writeJSON(w, http.StatusOK, movies, "movies")
+	//then passing all the data to writeResponse func in utilities for showing them in browser
+	err = app.writeResponse(w, r, http.StatusOK, movies, "movies")
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorResponse(w, r, err)
 		return
 	}
 }
@@ -130,109 +159,479 @@ func (app *application) deleteMovie(w http.ResponseWriter, r *http.Request) {
 	//converting the id to int cause it comes as string
 	id, err := strconv.Atoi(params.ByName("id"))
 	if err != nil{
-		app.errorJSON(w,err)
+		app.errorResponse(w, r, err)
 		return
 	}
 
-	//finally deleting the movie by passing the id to DeleteMoviesDb func
-	err =  app.models.DB.DeleteMovieDb(id)
+	//finally deleting the movie by passing the id to DeleteMoviesDb func.The movie only goes to the trash so it can still be restored
+	err =  app.models.Movies.DeleteMovieDb(r.Context(), id)
+	if errors.Is(err, models.ErrNotFound) {
+		app.errorResponse(w, r, err, http.StatusNotFound)
+		return
+	}
 	if err != nil{
-		app.errorJSON(w,err)
+		app.errorResponse(w, r, err)
 		return
 	}
 
-	//writing a positive response so we can know that the operation was a success
-	ok := jsonResp{
-		OK:true,
+	//sending a positive response so the frontend knows the operation was a success
+	app.writeOK(w, r)
+}
+
+//lists all the movies in the trash
+func (app *application) getTrash(w http.ResponseWriter, r *http.Request) {
+	movies, err := app.models.Movies.DeletedMovies(r.Context())
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
 	}
 
-	//sending the positive response to frontend
-	err = app.writeJSON(w,http.StatusOK,ok,"response")
-	if err != nil{
-		app.errorJSON(w,err)
+	err = app.writeResponse(w, r, http.StatusOK, movies, "movies")
+	if err != nil {
+		app.errorResponse(w, r, err)
 		return
 	}
 }
 
+//takes a movie back out of the trash
+func (app *application) restoreMovie(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Movies.RestoreMovie(r.Context(), id)
+	if errors.Is(err, models.ErrNotFound) {
+		app.errorResponse(w, r, errors.New("movie is not in the trash"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
+
 func (app *application) insertMovie(w http.ResponseWriter, r *http.Request) {
 
 }
 
-//creating a temporary payload to store all the string type data from frontend
+//FlexInt is a number in json that older clients may also send as a string like "120".An empty string is 0
+type FlexInt int
+
+func (n *FlexInt) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+
+	//the old frontend sends every number as a string
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		var err error
+		s, err = strconv.Unquote(s)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(s) == "" {
+			*n = 0
+			return nil
+		}
+	}
+
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("%s is not a whole number", b)
+	}
+
+	*n = FlexInt(v)
+	return nil
+}
+
+//MoviePayload is what the frontend sends to editMovie.Numbers can be json numbers or strings and the release date
+//YYYY-MM-DD or RFC3339, so both the old all-strings payloads and typed ones work
 type MoviePayload struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Year        string `json:"year"`
-	ReleaseDate string `json:"release_date"`
-	Runtime     string `json:"runtime"`
-	Rating      string `json:"rating"`
-	MPAARating  string `json:"mpaa_rating"`
+	ID          FlexInt     `json:"id"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Year        FlexInt     `json:"year"`
+	ReleaseDate models.Date `json:"release_date"`
+	Runtime     FlexInt     `json:"runtime"`
+	Rating      FlexInt     `json:"rating"`
+	MPAARating  string      `json:"mpaa_rating"`
+	//leaving credits out keeps the cast and crew as they are, an empty list removes them all
+	Credits []CreditPayload `json:"credits"`
 }
 
-//for adding a movie data or update existing one
-func (app *application) editMovie(w http.ResponseWriter, r *http.Request) {
-	var payload MoviePayload
+//CreditPayload is one cast or crew entry in MoviePayload.Either person_id or name is needed
+type CreditPayload struct {
+	PersonID     int    `json:"person_id"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	Character    string `json:"character"`
+	BillingOrder int    `json:"billing_order"`
+}
 
-	//taking data from request body and pushing them to payload struct temporarily (cause the data coming from frontend is all string type and we dont wanna take the hassle to convert all one by one)
-	err := json.NewDecoder(r.Body).Decode(&payload)
-	if err != nil {
-		log.Println(err)
-		app.errorJSON(w, err)
-		return
+//toCredits checks the credits from the payload and turns them into models.Credit
+func (p MoviePayload) toCredits() ([]*models.Credit, error) {
+	credits := []*models.Credit{}
+
+	for i, c := range p.Credits {
+		switch c.Role {
+		case models.RoleActor, models.RoleDirector, models.RoleWriter:
+		default:
+			return nil, fmt.Errorf("credits[%d]: role must be actor, director or writer", i)
+		}
+
+		c.Name = strings.TrimSpace(c.Name)
+		if c.PersonID == 0 && c.Name == "" {
+			return nil, fmt.Errorf("credits[%d]: person_id or name is required", i)
+		}
+
+		credits = append(credits, &models.Credit{
+			PersonID:     c.PersonID,
+			Name:         c.Name,
+			Role:         c.Role,
+			Character:    c.Character,
+			BillingOrder: c.BillingOrder,
+		})
 	}
 
-	//this is the main game.
-	var movie models.Movie
+	return credits, nil
+}
+
+//validate checks the fields every saved movie needs.Imports and graphql check their movies with it too, so a movie one of them
+//takes is one the others take as well
+func (p MoviePayload) validate() error {
+	if strings.TrimSpace(p.Title) == "" {
+		return errors.New("title is required")
+	}
+	if p.ReleaseDate.IsZero() {
+		return errors.New("release_date is required")
+	}
+	if p.Runtime < 0 {
+		return errors.New("runtime can't be negative")
+	}
+	if p.Rating < 0 || p.Rating > 5 {
+		return errors.New("rating must be between 0 and 5")
+	}
+	return nil
+}
 
-	//if we edit an existing movie this code snippet will run.
-	//Note that we are ignoring err by using "_"(blank variables).But we should not do that in production
-	if payload.ID != "0"{
-		id, _ := strconv.Atoi(payload.ID)
-		m, _ := app.models.DB.Get(id)
-		movie := *m
-		movie.Updated_At = time.Now()
+//saveMovie checks the payload, copies it onto movie and saves the movie and its credits.
+//movie is an empty models.Movie for new movies and the saved one for updates, so what the payload doesn't have stays as it is
+func (app *application) saveMovie(ctx context.Context, movie *models.Movie, payload MoviePayload) error {
+	err := payload.validate()
+	if err != nil {
+		return err
 	}
 
-	//converting and pushing all data into our main Movie struct
-	movie.ID, _ = strconv.Atoi(payload.ID)
-	movie.Title = payload.Title
+	//check the credits before we save anything
+	var credits []*models.Credit
+	if payload.Credits != nil {
+		credits, err = payload.toCredits()
+		if err != nil {
+			return err
+		}
+	}
+
+	movie.Title = strings.TrimSpace(payload.Title)
 	movie.Description = payload.Description
-	movie.ReleaseDate, _ = time.Parse("2006-01-02", payload.ReleaseDate)
+	movie.ReleaseDate = payload.ReleaseDate
 	movie.Year = movie.ReleaseDate.Year()
-	movie.Runtime, _ = strconv.Atoi(payload.Runtime)
-	movie.Rating, _ = strconv.Atoi(payload.Rating)
+	movie.Runtime = int(payload.Runtime)
+	movie.Rating = int(payload.Rating)
 	movie.MPAARating = payload.MPAARating
-	movie.Created_At = time.Now()
 	movie.Updated_At = time.Now()
 
-	//finally passing down the data to database
-	//if we are adding a new movie in the database the "if" clause will run.And if we edit an existing one the else clause will run
-	if movie.ID == 0{
-		err = app.models.DB.InsertMovie(movie)
-		if err != nil {
-			app.errorJSON(w, err)
-			return
+	//new movies don't have an id yet
+	isNew := movie.ID == 0
+	if isNew {
+		movie.Created_At = movie.Updated_At
+	}
+
+	//a movie is never saved without its credits
+	return app.models.WithTx(ctx, func(tx models.Models) error {
+		var err error
+		if isNew {
+			err = tx.Movies.InsertMovie(ctx, movie)
+		} else {
+			err = tx.Movies.UpdateMovie(ctx, movie)
 		}
-	} else{
-		err = app.models.DB.UpdateMovie(movie)
 		if err != nil {
-			app.errorJSON(w, err)
+			return err
+		}
+
+		//credits need the movie id so they are saved after the movie
+		if credits != nil {
+			return tx.People.SetMovieCredits(ctx, movie.ID, credits)
+		}
+		return nil
+	})
+}
+
+//saveMovieError answers a failed saveMovie.A movie can go to the trash after it was loaded, then it isn't found anymore
+func (app *application) saveMovieError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, models.ErrNotFound) {
+		app.errorResponse(w, r, errors.New("movie not found"), http.StatusNotFound)
+		return
+	}
+	app.errorResponse(w, r, err)
+}
+
+//movieFromParams loads the movie in the :id url parameter.If there is none the error response is already written and nil is returned
+func (app *application) movieFromParams(w http.ResponseWriter, r *http.Request) *models.Movie {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, errors.New("invalid id parameter"))
+		return nil
+	}
+
+	movie, err := app.models.Movies.Get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorResponse(w, r, errors.New("movie not found"), http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return nil
+	}
+	return movie
+}
+
+//writeMovie sends the movie as it is saved now, with its genres, credits and images
+func (app *application) writeMovie(w http.ResponseWriter, r *http.Request, status, id int) {
+	movie, err := app.models.Movies.Get(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+	app.attachImages(movie)
+	setLastModified(w, movie.Updated_At)
+
+	err = app.writeResponse(w, r, status, movie, "movie")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
+
+//POST /v1/movies creates a movie and answers 201 with the movie and where to find it
+func (app *application) createMovie(w http.ResponseWriter, r *http.Request) {
+	var payload MoviePayload
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if payload.ID != 0 {
+		app.errorResponse(w, r, errors.New("id is picked by the server, use PUT /v1/movies/:id to update a movie"))
+		return
+	}
+
+	var movie models.Movie
+	err = app.saveMovie(r.Context(), &movie, payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	app.writeMovie(w, r, http.StatusCreated, movie.ID)
+}
+
+//PUT /v1/movies/:id replaces a movie.Fields left out are emptied, use PATCH to change only some of them
+func (app *application) replaceMovie(w http.ResponseWriter, r *http.Request) {
+	movie := app.movieFromParams(w, r)
+	if movie == nil {
+		return
+	}
+
+	var payload MoviePayload
+
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if payload.ID != 0 && int(payload.ID) != movie.ID {
+		app.errorResponse(w, r, errors.New("id in the body doesn't match the url"))
+		return
+	}
+
+	err = app.saveMovie(r.Context(), movie, payload)
+	if err != nil {
+		app.saveMovieError(w, r, err)
+		return
+	}
+
+	app.writeMovie(w, r, http.StatusOK, movie.ID)
+}
+
+//PATCH /v1/movies/:id changes only the fields in the body, following json merge patch (RFC 7396).
+//A null field is emptied and "credits" replaces the whole cast and crew when it is given
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request) {
+	movie := app.movieFromParams(w, r)
+	if movie == nil {
+		return
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, _ := mime.ParseMediaType(ct)
+		if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+			app.errorResponse(w, r, errors.New("send application/merge-patch+json"), http.StatusUnsupportedMediaType)
 			return
 		}
 	}
 
-	//sets a response that everything worked well
-	ok := jsonResp{
-		OK: true,
+	var patch map[string]interface{}
+	err := app.readJSON(w, r, &patch)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	//the movie as it is now, in the same shape the patch comes in.Credits are left out so they only change when the patch has them
+	current := MoviePayload{
+		ID:          FlexInt(movie.ID),
+		Title:       movie.Title,
+		Description: movie.Description,
+		Year:        FlexInt(movie.Year),
+		ReleaseDate: movie.ReleaseDate,
+		Runtime:     FlexInt(movie.Runtime),
+		Rating:      FlexInt(movie.Rating),
+		MPAARating:  movie.MPAARating,
+	}
+	doc, err := toJSONObject(current)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	merged, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
 	}
 
-	//passing the response to browser
-	err = app.writeJSON(w, http.StatusOK, ok, "response")
+	//the merged movie goes through the same strict decoding as a PUT body
+	var payload MoviePayload
+	err = decodeJSON(bytes.NewReader(merged), &payload)
 	if err != nil {
-		app.errorJSON(w, err)
+		app.errorResponse(w, r, err)
 		return
 	}
+
+	if payload.ID != 0 && int(payload.ID) != movie.ID {
+		app.errorResponse(w, r, errors.New("id can't be changed"))
+		return
+	}
+
+	//"credits": null removes the whole cast and crew
+	if credits, ok := patch["credits"]; ok && credits == nil {
+		payload.Credits = []CreditPayload{}
+	}
+
+	err = app.saveMovie(r.Context(), movie, payload)
+	if err != nil {
+		app.saveMovieError(w, r, err)
+		return
+	}
+
+	app.writeMovie(w, r, http.StatusOK, movie.ID)
+}
+
+//toJSONObject turns v into the map json.Unmarshal would make of it, dropping null fields
+func toJSONObject(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range doc {
+		if v == nil {
+			delete(doc, k)
+		}
+	}
+	return doc, nil
+}
+
+//mergePatch applies a json merge patch (RFC 7396) to target.Objects are merged field by field, null removes a field
+//and anything else, arrays included, replaces what was there
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+//for adding a movie data or update existing one.This is the old endpoint from before POST, PUT and PATCH on /v1/movies.
+//It stays for the frontend that still uses it: an id of "0" creates the movie, anything else updates it
+func (app *application) editMovie(w http.ResponseWriter, r *http.Request) {
+	var payload MoviePayload
+
+	//taking data from request body and pushing them to payload struct.FlexInt and models.Date do the converting for us
+	err := app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	//this is the main game.New movies start empty and updates start from the saved movie, so created_at and the images stay
+	movie := &models.Movie{}
+	if payload.ID != 0 {
+		movie, err = app.models.Movies.Get(r.Context(), int(payload.ID))
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorResponse(w, r, errors.New("movie not found"), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+	}
+
+	//finally passing down the data to database
+	err = app.saveMovie(r.Context(), movie, payload)
+	if err != nil {
+		app.saveMovieError(w, r, err)
+		return
+	}
+
+	//the client gets the saved movie back so it learns the id of a new one
+	status := http.StatusOK
+	if payload.ID == 0 {
+		status = http.StatusCreated
+	}
+	app.writeMovie(w, r, status, movie.ID)
 }
 
 func (app *application) searchMovies(w http.ResponseWriter, r *http.Request) {
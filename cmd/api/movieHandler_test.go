@@ -0,0 +1,159 @@
+package main
+
+import (
+	"backend/models"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestMoviePayloadDecoding(t *testing.T) {
+	release := time.Date(2022, time.March, 25, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		body string
+		err  string
+	}{
+		{"strings", `{"id": "7", "title": "The Batman", "release_date": "2022-03-25", "runtime": "176", "rating": "4"}`, ""},
+		{"numbers", `{"id": 7, "title": "The Batman", "release_date": "2022-03-25", "runtime": 176, "rating": 4}`, ""},
+		{"rfc3339", `{"id": 7, "title": "The Batman", "release_date": "2022-03-25T21:30:00+02:00", "runtime": 176, "rating": 4}`, ""},
+		{"bad number", `{"id": 7, "runtime": "long"}`, `"long" is not a whole number`},
+		{"float", `{"id": 7, "runtime": 176.5}`, `176.5 is not a whole number`},
+		{"bad date", `{"id": 7, "release_date": "25/03/2022"}`, `"25/03/2022" is not a date, use YYYY-MM-DD or RFC3339`},
+	}
+
+	app := &application{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+
+			var payload MoviePayload
+			err := app.readJSON(httptest.NewRecorder(), r, &payload)
+
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if payload.ID != 7 || payload.Runtime != 176 || payload.Rating != 4 {
+				t.Errorf("got id %d, runtime %d, rating %d", payload.ID, payload.Runtime, payload.Rating)
+			}
+			if !payload.ReleaseDate.Equal(release) {
+				t.Errorf("got release date %v", payload.ReleaseDate)
+			}
+		})
+	}
+}
+
+func TestEmptyStringsAreZero(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id": "0", "runtime": "", "release_date": ""}`))
+
+	var payload MoviePayload
+	err := (&application{}).readJSON(httptest.NewRecorder(), r, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID != 0 || payload.Runtime != 0 || !payload.ReleaseDate.IsZero() {
+		t.Errorf("expected zero values, got %+v", payload)
+	}
+}
+
+func TestDateRoundTrip(t *testing.T) {
+	movie := models.Movie{Title: "The Batman", ReleaseDate: models.NewDate(time.Date(2022, time.March, 25, 21, 30, 0, 0, time.UTC))}
+
+	js, err := json.Marshal(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(js), `"release_date":"2022-03-25"`) {
+		t.Errorf("expected a date only release_date, got %s", js)
+	}
+
+	var back models.Movie
+	err = json.Unmarshal(js, &back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.ReleaseDate != movie.ReleaseDate {
+		t.Errorf("got %v back, want %v", back.ReleaseDate, movie.ReleaseDate)
+	}
+
+	//what a response sends can be sent back to editmovie
+	var payload MoviePayload
+	err = json.Unmarshal(js, &payload)
+	if err != nil || payload.ReleaseDate != movie.ReleaseDate {
+		t.Errorf("got %v, %v", payload.ReleaseDate, err)
+	}
+
+	//the zero date is null both ways
+	js, _ = json.Marshal(models.Movie{})
+	if !strings.Contains(string(js), `"release_date":null`) {
+		t.Errorf("expected a null release_date, got %s", js)
+	}
+	back = models.Movie{ReleaseDate: movie.ReleaseDate}
+	json.Unmarshal(js, &back)
+	if !back.ReleaseDate.IsZero() {
+		t.Errorf("expected a zero date, got %v", back.ReleaseDate)
+	}
+
+	//msgpack writes the same string
+	var buf bytes.Buffer
+	err = msgpackEncoder{}.encode(&buf, map[string]interface{}{"movie": movie})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]map[string]interface{}
+	err = msgpack.Unmarshal(buf.Bytes(), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded["movie"]["release_date"] != "2022-03-25" {
+		t.Errorf("expected a date only release_date, got %#v", decoded["movie"]["release_date"])
+	}
+}
+
+//the examples from RFC 7396 appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		var target, patch interface{}
+		json.Unmarshal([]byte(tt.target), &target)
+		json.Unmarshal([]byte(tt.patch), &patch)
+
+		got, _ := json.Marshal(mergePatch(target, patch))
+		if string(got) != tt.want {
+			t.Errorf("%s + %s: got %s, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
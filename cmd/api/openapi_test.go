@@ -0,0 +1,244 @@
+package main
+
+import (
+	"backend/models"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type openAPIDoc struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+
+	b, err := docs.ReadFile("docs/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc openAPIDoc
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		t.Fatalf("openapi.json is not valid json: %v", err)
+	}
+	return doc
+}
+
+//registeredRoutes reads routes.go and returns every route as "method path" in openapi form, like "get /v1/movies/{id}".
+//httprouter can't list its routes so we look at the code instead
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "routes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var routes []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if recv, ok := sel.X.(*ast.Ident); !ok || recv.Name != "router" {
+			return true
+		}
+
+		var method string
+		var args []ast.Expr
+		switch sel.Sel.Name {
+		case "GET", "POST", "PUT", "PATCH", "DELETE":
+			method, args = sel.Sel.Name, call.Args
+		case "Handle", "Handler", "HandlerFunc":
+			m, ok := call.Args[0].(*ast.SelectorExpr)
+			if !ok {
+				t.Fatalf("router.%s needs an http.MethodX method", sel.Sel.Name)
+			}
+			method, args = strings.ToUpper(strings.TrimPrefix(m.Sel.Name, "Method")), call.Args[1:]
+		default:
+			return true
+		}
+
+		path := stringLit(t, args[0])
+
+		//routes behind onlyParam only answer for one value of the parameter
+		ast.Inspect(call, func(n ast.Node) bool {
+			c, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if s, ok := c.Fun.(*ast.SelectorExpr); ok && s.Sel.Name == "onlyParam" {
+				path = strings.Replace(path, ":"+stringLit(t, c.Args[0]), stringLit(t, c.Args[1]), 1)
+			}
+			return true
+		})
+
+		routes = append(routes, strings.ToLower(method)+" "+openAPIPath(path))
+		return true
+	})
+
+	sort.Strings(routes)
+	return routes
+}
+
+func stringLit(t *testing.T, e ast.Expr) string {
+	t.Helper()
+
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		t.Fatalf("expected a string literal in routes.go")
+	}
+	s, _ := strconv.Unquote(lit.Value)
+	return s
+}
+
+//openAPIPath turns /v1/movies/:id and /v1/images/*filepath into /v1/movies/{id} and /v1/images/{filepath}
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") || strings.HasPrefix(p, "*") {
+			parts[i] = "{" + p[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	doc := loadOpenAPI(t)
+	routes := registeredRoutes(t)
+	if len(routes) == 0 {
+		t.Fatal("found no routes in routes.go")
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range routes {
+		registered[route] = true
+
+		parts := strings.SplitN(route, " ", 2)
+		if _, ok := doc.Paths[parts[1]][parts[0]]; !ok {
+			t.Errorf("%s is registered in routes() but not in docs/openapi.json", route)
+		}
+	}
+
+	//and the other way round, so removed routes don't stay documented
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if method == "parameters" {
+				continue
+			}
+			if !registered[method+" "+path] {
+				t.Errorf("%s %s is in docs/openapi.json but not registered in routes()", method, path)
+			}
+		}
+	}
+}
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	types := map[string]interface{}{
+		"jsonResp":         jsonResp{},
+		"AppStatus":        AppStatus{},
+		"Credentials":      Credentials{},
+		"MoviePayload":     MoviePayload{},
+		"CreditPayload":    CreditPayload{},
+		"ReviewPayload":    ReviewPayload{},
+		"ListPayload":      ListPayload{},
+		"ListMoviePayload": ListMoviePayload{},
+		"ListOrderPayload": ListOrderPayload{},
+		"Page":             pagedResult{},
+		"ImportReport":     importReport{},
+		"Movie":            models.Movie{},
+		"Genre":            models.Genre{},
+		"Credit":           models.Credit{},
+		"Review":           models.Review{},
+		"List":             models.List{},
+		"Person":           models.Person{},
+		"MovieRevision":    models.MovieRevision{},
+		"FieldChange":      models.FieldChange{},
+		"ImportResult":     models.ImportResult{},
+		"QueryStats":       models.QueryStats{},
+	}
+
+	for name, v := range types {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is missing", name)
+			continue
+		}
+
+		want := jsonFields(reflect.TypeOf(v))
+		var got []string
+		for field := range schema.Properties {
+			got = append(got, field)
+		}
+		sort.Strings(got)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("schema %s has %v, the Go type has %v", name, got, want)
+		}
+	}
+}
+
+//jsonFields is the names encoding/json uses for the fields of t
+func jsonFields(t reflect.Type) []string {
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	app := &application{}
+	srv := app.routes()
+
+	for path, contentType := range map[string]string{
+		"/v1/openapi.json": "application/json",
+		"/v1/docs":         "text/html; charset=utf-8",
+	} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got status %d", path, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != contentType {
+			t.Errorf("%s: got Content-Type %q", path, got)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"backend/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//returns a person with their filmography
+func (app *application) getPerson(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	person, err := app.models.People.GetPerson(r.Context(), id)
+	if errors.Is(err, models.ErrNotFound) {
+		app.errorResponse(w, r, errors.New("person not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, person, "person")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
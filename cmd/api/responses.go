@@ -0,0 +1,239 @@
+package main
+
+import (
+	"backend/models"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+//responseEncoder writes the response envelope (the one key map writeResponse makes) in one format
+type responseEncoder interface {
+	contentType() string
+	encode(w io.Writer, envelope map[string]interface{}) error
+}
+
+//encoders we can answer with.The first one is used when the client doesn't care
+var encoders = []responseEncoder{jsonEncoder{}, xmlEncoder{}, msgpackEncoder{}}
+
+//negotiate picks the encoder for an Accept header, following the q values.It returns false if we can't send anything the client accepts
+func negotiate(accept string) (responseEncoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return encoders[0], true
+	}
+
+	type option struct {
+		mediaType string
+		q         float64
+	}
+	var options []option
+	//types the client listed with q=0, they are never sent even if a wildcard matches them
+	refused := make(map[string]bool)
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+		//q=0 means "not this one"
+		if q <= 0 {
+			refused[mediaType] = true
+			continue
+		}
+		options = append(options, option{mediaType, q})
+	}
+
+	//highest q first, and for the same q the one listed first
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].q > options[j].q
+	})
+
+	for _, o := range options {
+		for _, enc := range encoders {
+			if !refused[enc.contentType()] && matchMediaType(o.mediaType, enc.contentType()) {
+				return enc, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+//matchMediaType checks a media range from an Accept header, like application/* or */*, against a content type
+func matchMediaType(mediaRange, contentType string) bool {
+	if mediaRange == "*/*" || mediaRange == contentType {
+		return true
+	}
+	if strings.HasSuffix(mediaRange, "/*") {
+		return strings.HasPrefix(contentType, strings.TrimSuffix(mediaRange, "*"))
+	}
+	return false
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) contentType() string {
+	return "application/json"
+}
+
+func (jsonEncoder) encode(w io.Writer, envelope map[string]interface{}) error {
+	js, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(js)
+	return err
+}
+
+//msgpackEncoder uses the json tags so the field names are the same as in json
+type msgpackEncoder struct{}
+
+//dates are strings like in json.Without this msgpack would pick the binary form of the time.Time inside
+func init() {
+	msgpack.Register(models.Date{}, func(e *msgpack.Encoder, v reflect.Value) error {
+		d := v.Interface().(models.Date)
+		if d.IsZero() {
+			return e.EncodeNil()
+		}
+		return e.EncodeString(d.Format(models.DateLayout))
+	}, nil)
+}
+
+func (msgpackEncoder) contentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackEncoder) encode(w io.Writer, envelope map[string]interface{}) error {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.SetSortMapKeys(true)
+
+	err := enc.Encode(envelope)
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+//xmlEncoder writes the envelope as <response><key>...</key></response>.
+//encoding/xml can't do maps, so the data goes through json first and the xml is built from that.
+//That way the element names and what is left out are the same as in json.
+//Map keys that can't be element names (like genre ids) become <item key="...">, and list entries are <item> elements
+type xmlEncoder struct{}
+
+func (xmlEncoder) contentType() string {
+	return "application/xml"
+}
+
+func (xmlEncoder) encode(w io.Writer, envelope map[string]interface{}) error {
+	js, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	//keeps numbers as they were written instead of turning them into floats
+	dec.UseNumber()
+	err = dec.Decode(&generic)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	err = writeXMLValue(enc, xml.StartElement{Name: xml.Name{Local: "response"}}, generic)
+	if err != nil {
+		return err
+	}
+	err = enc.Flush()
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func writeXMLValue(enc *xml.Encoder, start xml.StartElement, value interface{}) error {
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			child := xml.StartElement{Name: xml.Name{Local: k}}
+			if !isXMLName(k) {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "item"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: k}},
+				}
+			}
+			err = writeXMLValue(enc, child, v[k])
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			err = writeXMLValue(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item)
+			if err != nil {
+				return err
+			}
+		}
+	case nil:
+		//null is an empty element
+	default:
+		err = enc.EncodeToken(xml.CharData(fmt.Sprint(v)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+//isXMLName checks that s can be used as an element name.We only allow the simple names our json keys use
+func isXMLName(s string) bool {
+	if s == "" || strings.HasPrefix(strings.ToLower(s), "xml") {
+		return false
+	}
+	for i, r := range s {
+		letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_'
+		if i == 0 && !letter {
+			return false
+		}
+		if !letter && !(r >= '0' && r <= '9') && r != '-' && r != '.' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"backend/models"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//ReviewPayload is what a user sends to rate and review a movie
+type ReviewPayload struct {
+	Rating int    `json:"rating"`
+	Body   string `json:"body"`
+}
+
+//lists the visible reviews of a movie one page at a time
+func (app *application) getMovieReviews(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	page, pageSize, err := app.readPagination(r)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	reviews, total, err := app.models.Reviews.MovieReviews(r.Context(), id, page, pageSize)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	result := pagedResult{
+		Items:    reviews,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, result, "reviews")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
+
+//adds the signed in user's review of a movie.Sending it again edits the review
+func (app *application) saveMovieReview(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	var payload ReviewPayload
+
+	err = app.readJSON(w, r, &payload)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	if payload.Rating < 1 || payload.Rating > 5 {
+		app.errorResponse(w, r, errors.New("rating must be between 1 and 5"))
+		return
+	}
+
+	//we can only review movies that exist and aren't in the trash
+	_, err = app.models.Movies.Get(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorResponse(w, r, errors.New("movie not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	review := models.Review{
+		MovieID:    id,
+		UserID:     app.userID(r),
+		Rating:     payload.Rating,
+		Body:       payload.Body,
+		Created_At: time.Now(),
+		Updated_At: time.Now(),
+	}
+
+	err = app.models.Reviews.SaveReview(r.Context(), review)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
+
+//lets an admin hide a review, or show it again by sending {"hidden": false}
+func (app *application) hideReview(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	//hiding is the default when nothing is sent
+	payload := struct {
+		Hidden bool `json:"hidden"`
+	}{Hidden: true}
+
+	if r.ContentLength != 0 {
+		err = app.readJSON(w, r, &payload)
+		if err != nil {
+			app.errorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Reviews.HideReview(r.Context(), id, payload.Hidden)
+	if errors.Is(err, models.ErrNotFound) {
+		app.errorResponse(w, r, errors.New("review not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
+
+//lets an admin delete a review for good
+func (app *application) deleteReview(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Reviews.DeleteReview(r.Context(), id)
+	if errors.Is(err, models.ErrNotFound) {
+		app.errorResponse(w, r, errors.New("review not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
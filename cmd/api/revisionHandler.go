@@ -0,0 +1,90 @@
+package main
+
+import (
+	"backend/models"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+//lists every saved version of a movie with what changed between them
+func (app *application) getMovieRevisions(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	revisions, err := app.models.Movies.MovieRevisions(r.Context(), id)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, revisions, "revisions")
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+}
+
+//errNoRevision tells a missing revision from a missing movie, the models say ErrNotFound for both
+var errNoRevision = errors.New("revision not found")
+
+//puts a movie back the way it was in an old revision.This goes through UpdateMovie so the rollback is saved as a new revision itself
+func (app *application) rollbackMovie(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	revisionNumber, err := strconv.Atoi(params.ByName("revision"))
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	//the movie can't change between reading it and writing the old version back
+	err = app.models.WithTx(r.Context(), func(tx models.Models) error {
+		revision, err := tx.Movies.MovieRevision(r.Context(), id, revisionNumber)
+		if errors.Is(err, models.ErrNotFound) {
+			return errNoRevision
+		}
+		if err != nil {
+			return err
+		}
+
+		movie, err := tx.Movies.Get(r.Context(), id)
+		if err != nil {
+			return err
+		}
+
+		revision.Apply(movie)
+		movie.Updated_At = time.Now()
+		return tx.Movies.UpdateMovie(r.Context(), movie)
+	})
+	if errors.Is(err, errNoRevision) {
+		app.errorResponse(w, r, err, http.StatusNotFound)
+		return
+	}
+	//UpdateMovie doesn't find movies that went to the trash in the meantime
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, models.ErrNotFound) {
+		app.errorResponse(w, r, errors.New("movie not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	app.writeOK(w, r)
+}
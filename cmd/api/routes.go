@@ -8,11 +8,24 @@ import (
 	"github.com/justinas/alice"
 )
 
+//onlyParam serves next only when the url parameter has exactly the given value, anything else is a 404.
+//httprouter doesn't allow a fixed path like /v1/admin/movies/import next to /v1/admin/movies/:id/..., so we register
+//those on the :id path and check the value here
+func (app *application) onlyParam(name, value string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if httprouter.ParamsFromContext(r.Context()).ByName(name) != value {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 //this function is gonna secure our route
 func (app *application) wrap(next http.Handler) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		//pass httprouter.Params to request context
-		ctx := context.WithValue(r.Context(), "params", ps)
+		//pass httprouter.Params to request context.It has to be httprouter.ParamsKey or ParamsFromContext won't find them
+		ctx := context.WithValue(r.Context(), httprouter.ParamsKey, ps)
 		//call next middleware with new context
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
@@ -24,22 +37,78 @@ func (app *application) routes() http.Handler {
 
 	//adding middleware to the chain variable.We can add as many middlewares we want in here
 	secure := alice.New(app.checkToken)
+	//admin routes need a signed in user that is also an admin
+	admin := secure.Append(app.requireAdmin)
 
 	//usual routing procedure.method,url,function
 	router.HandlerFunc(http.MethodGet, "/status", app.statusHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/signin", app.SignIn)
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.getAllMovies)
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.getOneMovie)
+	//the public reads answer conditional requests with 304, see conditionalGET
+	router.Handler(http.MethodGet, "/v1/movies", app.conditionalGET("/v1/movies", http.HandlerFunc(app.getAllMovies)))
+	router.Handler(http.MethodGet, "/v1/movies/:id", app.conditionalGET("/v1/movies/:id", http.HandlerFunc(app.getOneMovie)))
+	router.POST("/v1/movies", app.wrap(secure.ThenFunc(app.createMovie)))
+	router.PUT("/v1/movies/:id", app.wrap(secure.ThenFunc(app.replaceMovie)))
+	router.PATCH("/v1/movies/:id", app.wrap(secure.ThenFunc(app.patchMovie)))
+	router.DELETE("/v1/movies/:id", app.wrap(secure.ThenFunc(app.deleteMovie)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.getMovieReviews)
+	router.POST("/v1/movies/:id/reviews", app.wrap(secure.ThenFunc(app.saveMovieReview)))
+
+	//lists belonging to the signed in user
+	router.GET("/v1/me/lists", app.wrap(secure.ThenFunc(app.getMyLists)))
+	router.POST("/v1/me/lists", app.wrap(secure.ThenFunc(app.createList)))
+	router.GET("/v1/me/lists/:id", app.wrap(secure.ThenFunc(app.getMyList)))
+	router.PUT("/v1/me/lists/:id", app.wrap(secure.ThenFunc(app.updateList)))
+	router.DELETE("/v1/me/lists/:id", app.wrap(secure.ThenFunc(app.deleteList)))
+	router.POST("/v1/me/lists/:id/movies", app.wrap(secure.ThenFunc(app.addListMovie)))
+	router.PUT("/v1/me/lists/:id/movies", app.wrap(secure.ThenFunc(app.reorderList)))
+	router.DELETE("/v1/me/lists/:id/movies/:movie_id", app.wrap(secure.ThenFunc(app.removeListMovie)))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:slug", app.getSharedList)
 
-	//Finally securing our route
+	//Finally securing our route.editmovie is the old way of saving movies, new clients use POST, PUT and PATCH on /v1/movies
 	router.POST("/v1/admin/editmovie",app.wrap(secure.ThenFunc(app.editMovie)))
 	// router.HandlerFunc(http.MethodPost, "/v1/admin/editmovie", app.editMovie)
 
-	router.HandlerFunc(http.MethodGet, "/v1/admin/deletemovie/:id", app.deleteMovie)
+	//the old way of deleting, kept for the frontend.New clients use DELETE /v1/movies/:id
+	router.GET("/v1/admin/deletemovie/:id", app.wrap(secure.ThenFunc(app.deleteMovie)))
+	router.GET("/v1/admin/trash", app.wrap(secure.ThenFunc(app.getTrash)))
+	router.POST("/v1/admin/restoremovie/:id", app.wrap(secure.ThenFunc(app.restoreMovie)))
+
+	//this is GET /v1/admin/movies/export, see onlyParam
+	router.GET("/v1/admin/movies/:id", app.wrap(secure.Then(app.onlyParam("id", "export", http.HandlerFunc(app.exportMoviesHandler)))))
+	router.GET("/v1/admin/movies/:id/revisions", app.wrap(secure.ThenFunc(app.getMovieRevisions)))
+	router.POST("/v1/admin/movies/:id/revisions/:revision/rollback", app.wrap(secure.ThenFunc(app.rollbackMovie)))
+
+	//this is POST /v1/admin/movies/import, see onlyParam
+	router.POST("/v1/admin/movies/:id", app.wrap(secure.Then(app.onlyParam("id", "import", http.HandlerFunc(app.importMoviesHandler)))))
+	router.POST("/v1/admin/movies/:id/poster", app.wrap(secure.ThenFunc(app.uploadMovieImage("poster"))))
+	router.POST("/v1/admin/movies/:id/backdrop", app.wrap(secure.ThenFunc(app.uploadMovieImage("backdrop"))))
+
+	router.POST("/v1/admin/reviews/:id/hide", app.wrap(admin.ThenFunc(app.hideReview)))
+	router.DELETE("/v1/admin/reviews/:id", app.wrap(admin.ThenFunc(app.deleteReview)))
 
-	router.HandlerFunc(http.MethodGet, "/v1/genres", app.getAllGenres)
-	router.HandlerFunc(http.MethodGet, "/v1/genres/:genre_id", app.getAllMoviesByGenre)
-	return app.enableCORS(router)
+	//query counts and latencies.Not expvar's /debug/vars, that would show the command line with the secrets in it
+	router.GET("/v1/admin/metrics", app.wrap(secure.ThenFunc(app.getMetrics)))
+
+	router.Handler(http.MethodGet, "/v1/genres", app.conditionalGET("/v1/genres", http.HandlerFunc(app.getAllGenres)))
+	router.Handler(http.MethodGet, "/v1/genres/:genre_id", app.conditionalGET("/v1/genres/:genre_id", http.HandlerFunc(app.getAllMoviesByGenre)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.getPerson)
+
+	//the api describing itself
+	router.HandlerFunc(http.MethodGet, "/v1/openapi.json", app.openAPIHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/docs", app.swaggerHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/docs/:file", app.swaggerFileHandler)
+
+	//one endpoint for everything the frontend wants in a single round trip
+	router.HandlerFunc(http.MethodPost, "/graphql", app.graphqlHandler(app.newGraphQLSchema()))
+
+	//when images are kept on disk we serve them ourselves
+	if files, ok := app.blobs.(http.Handler); ok {
+		router.Handler(http.MethodGet, "/v1/images/*filepath", http.StripPrefix("/v1/images", files))
+	}
+	//compress sits outside of negotiate so the 406 answers get the same treatment as everything else
+	return app.writeDeadline(app.enableCORS(app.compress(app.negotiate(router))))
 }
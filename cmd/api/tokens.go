@@ -2,7 +2,6 @@ package main
 
 import (
 	"backend/models"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -12,17 +11,10 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-//creating a dummy user
-var validUser = models.User{
-	ID:       10,
-	Email:    "me@gmail.com",
-	Password: "$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK",
-}
-
 //credentials used
 type Credentials struct {
-	Username string `json:email`
-	Password string `json:password`
+	Username string `json:"email"`
+	Password string `json:"password"`
 }
 
 //func for signing in
@@ -30,25 +22,36 @@ func (app *application) SignIn(w http.ResponseWriter, r *http.Request) {
 	var creds Credentials
 
 	//decode user data and save in Credentials struct
-	err := json.NewDecoder(r.Body).Decode(&creds)
+	err := app.readJSON(w, r, &creds)
+	if err != nil {
+		app.errorResponse(w, r, err)
+		return
+	}
+
+	//users live in the users table now, accounts are made with the user command
+	user, err := app.models.Users.GetUserByEmail(r.Context(), creds.Username)
+	if errors.Is(err, models.ErrNotFound) {
+		app.errorResponse(w, r, errors.New("Unauthorised"))
+		return
+	}
 	if err != nil {
-		app.errorJSON(w, errors.New("Unauthorized"))
+		app.errorResponse(w, r, err)
 		return
 	}
 
 	//we are gonna hash this
-	hashedPassword := validUser.Password
+	hashedPassword := user.Password
 
 	//CompareHashAndPassword compares a bcrypt hashed password with its possible plaintext equivalent.
 	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(creds.Password))
 	if err != nil {
-		app.errorJSON(w, errors.New("Unauthorised"))
+		app.errorResponse(w, r, errors.New("Unauthorised"))
 		return
 	}
 
 	//Setting properties to our jwt auth token
 	var claims jwt.Claims
-	claims.Subject = fmt.Sprint(validUser.ID)
+	claims.Subject = fmt.Sprint(user.ID)
 	claims.Issued = jwt.NewNumericTime(time.Now())
 	claims.NotBefore = jwt.NewNumericTime(time.Now())
 	claims.Expires = jwt.NewNumericTime(time.Now().Add(24 * time.Hour))
@@ -58,10 +61,10 @@ func (app *application) SignIn(w http.ResponseWriter, r *http.Request) {
 	//HMACSIGN creats signs in our token and we are using jwt.HS256 algorithm for it and then send our secret []byte in it
 	jwtBytes, err := claims.HMACSign(jwt.HS256, []byte(app.config.jwt.secret))
 	if err != nil {
-		app.errorJSON(w, errors.New("Unauthorised"))
+		app.errorResponse(w, r, errors.New("Unauthorised"))
 		return
 	}
 
 	//finally sending sending respond to frontend
-	app.writeJSON(w, http.StatusOK, jwtBytes, "response")
+	app.writeResponse(w, r, http.StatusOK, jwtBytes, "response")
 }
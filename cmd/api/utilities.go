@@ -1,36 +1,166 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
-//for converting data into json and sending them to browser
-func (app *application) writeJSON(w http.ResponseWriter, status int, data interface{}, wrap string) error {
+//default and biggest page size for paginated lists
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+//biggest json body we read, anything bigger is refused before it is decoded
+const maxBodySize = 1 << 20
+
+//pagedResult is how we send one page of a longer list
+type pagedResult struct {
+	Items    interface{} `json:"items"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+	Total    int         `json:"total"`
+}
+
+//readPagination gets page and page_size from the query string. Both are optional
+func (app *application) readPagination(r *http.Request) (int, int, error) {
+	page, pageSize := 1, defaultPageSize
+
+	qs := r.URL.Query()
+
+	if v := qs.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, errors.New("page must be a positive number")
+		}
+		page = n
+	}
+
+	if v := qs.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return 0, 0, errors.New("page_size must be between 1 and 100")
+		}
+		pageSize = n
+	}
+
+	return page, pageSize, nil
+}
+
+//readJSON decodes the request body into dst.Every handler reading json uses it so they all refuse the same things:
+//bodies bigger than maxBodySize, fields dst doesn't have, and anything after the first json value.
+//The errors say what is wrong and where so they can go to the client as they are
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	return decodeJSON(r.Body, dst)
+}
+
+//decodeJSON is readJSON for json that doesn't come straight from a request body, like a merge patched movie
+func decodeJSON(body io.Reader, dst interface{}) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains malformed json (at offset %d)", syntaxError.Offset)
+
+		//Decode gives this one for syntax errors too when the body ends in the middle of a value
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains malformed json")
+
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body has the wrong type for field %q (got %s, want %s)", unmarshalTypeError.Field, unmarshalTypeError.Value, unmarshalTypeError.Type)
+			}
+			return fmt.Errorf("body has the wrong type (at offset %d)", unmarshalTypeError.Offset)
+
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+
+		//there is no error type for unknown fields, only the message "json: unknown field "<name>""
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+
+		//http.MaxBytesError only came in go 1.19 so we go by the message here too
+		case err.Error() == "http: request body too large":
+			return fmt.Errorf("body must not be larger than %d bytes", maxBodySize)
+
+		//this means dst is wrong, which is our bug and not the client's
+		case errors.As(err, &invalidUnmarshalError):
+			panic(err)
+
+		default:
+			return err
+		}
+	}
+
+	//a second Decode only finds EOF when the body was exactly one json value
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single json value")
+	}
+
+	return nil
+}
+
+//for sending data to the browser.It comes as json, xml or msgpack depending on the Accept header, always wrapped in a one key map
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data interface{}, wrap string) error {
 	//wraps my content with a key
 	wrapper := make(map[string]interface{})
 
 	//wrap is the key
 	wrapper[wrap] = data
 
-	//converts wrapper content to json
-	js, err := json.Marshal(wrapper)
+	//the negotiate middleware already turned away clients we can't answer, so falling back to json only happens outside of it
+	enc, ok := negotiate(r.Header.Get("Accept"))
+	if !ok {
+		enc = encoders[0]
+	}
+
+	//encodes into a buffer first so an error doesn't leave half a response
+	var buf bytes.Buffer
+	err := enc.encode(&buf, wrapper)
 	//return error if occurs
 	if err != nil {
 		return err
 	}
 
-	//sends wrapper json data to browser
-	w.Header().Set("Content-Type", "application/json")
+	//sends wrapper data to browser
+	w.Header().Set("Content-Type", enc.contentType())
+	w.Header().Add("Vary", "Accept")
 	w.WriteHeader(status)
-	w.Write(js)
+	w.Write(buf.Bytes())
 
 	//return nothing.Have to use this cause we have a return type in our func
 	return nil
 }
 
+//writeOK sends the usual {"response":{"ok":true}}
+func (app *application) writeOK(w http.ResponseWriter, r *http.Request) {
+	ok := jsonResp{
+		OK: true,
+	}
+
+	err := app.writeResponse(w, r, http.StatusOK, ok, "response")
+	if err != nil {
+		app.errorResponse(w, r, err)
+	}
+}
+
 //for better error handling. status ...int means that it is not a required argument
-func (app *application) errorJSON(w http.ResponseWriter, err error, status ...int) {
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, err error, status ...int) {
 
 	//By default it send http.StatusBadRequest as our response to frontend
 	statusCode := http.StatusBadRequest
@@ -51,6 +181,6 @@ func (app *application) errorJSON(w http.ResponseWriter, err error, status ...in
 		Message: err.Error(),
 	}
 
-	//finally sends all the info to writeJSON function
-	app.writeJSON(w, statusCode, theError, "error")
+	//finally sends all the info to writeResponse function
+	app.writeResponse(w, r, statusCode, theError, "error")
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  string
+	}{
+		{"valid", `{"name": "Weekend", "public": true}`, ""},
+		{"empty", ``, "body must not be empty"},
+		{"malformed", `{"name": "Weekend",}`, "body contains malformed json (at offset 20)"},
+		{"truncated", `{"name": "Week`, "body contains malformed json"},
+		{"wrong type", `{"name": 12}`, `body has the wrong type for field "name" (got number, want string)`},
+		{"not an object", `["Weekend"]`, "body has the wrong type (at offset 1)"},
+		{"unknown field", `{"name": "Weekend", "colour": "red"}`, `body contains unknown field "colour"`},
+		{"two values", `{"name": "Weekend"}{"name": "Other"}`, "body must only contain a single json value"},
+		{"trailing garbage", `{"name": "Weekend"} x`, "body must only contain a single json value"},
+		{"too large", `{"name": "` + strings.Repeat("a", maxBodySize) + `"}`, "body must not be larger than 1048576 bytes"},
+	}
+
+	app := &application{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			var payload ListPayload
+			err := app.readJSON(w, r, &payload)
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && err == nil:
+				t.Fatalf("expected %q, got no error", tt.err)
+			case tt.err != "" && err.Error() != tt.err:
+				t.Fatalf("expected %q, got %q", tt.err, err.Error())
+			}
+		})
+	}
+}
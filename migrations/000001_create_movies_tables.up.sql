@@ -0,0 +1,28 @@
+-- the base schema used to be created by hand. if not exists keeps this safe to run on an existing database
+create table if not exists movies (
+    id serial primary key,
+    title character varying not null,
+    description text not null default '',
+    year integer not null default 0,
+    release_date date,
+    runtime integer not null default 0,
+    rating integer not null default 0,
+    mpaa_rating character varying not null default '',
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+create table if not exists genres (
+    id serial primary key,
+    genre_name character varying not null,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+create table if not exists movies_genres (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    genre_id integer not null references genres (id) on delete cascade,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
@@ -0,0 +1,4 @@
+-- a movie with deleted_at set is in the trash. it gets removed for good by the purge command
+alter table movies add column if not exists deleted_at timestamp without time zone;
+
+create index if not exists movies_deleted_at_idx on movies (deleted_at);
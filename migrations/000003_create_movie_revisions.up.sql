@@ -0,0 +1,15 @@
+-- every UpdateMovie stores a full copy of the movie here so editors can browse old versions and roll back
+create table if not exists movie_revisions (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    revision integer not null,
+    title character varying not null,
+    description text not null default '',
+    year integer not null default 0,
+    release_date date,
+    runtime integer not null default 0,
+    rating integer not null default 0,
+    mpaa_rating character varying not null default '',
+    created_at timestamp without time zone not null default now(),
+    unique (movie_id, revision)
+);
@@ -0,0 +1,12 @@
+-- one rating and review per user per movie. hidden reviews are kept but not shown or counted
+create table if not exists reviews (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    user_id integer not null,
+    rating integer not null check (rating between 1 and 5),
+    body text not null default '',
+    hidden boolean not null default false,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now(),
+    unique (movie_id, user_id)
+);
@@ -0,0 +1,24 @@
+-- user owned movie lists. every user gets one default list called Favourites
+create table if not exists lists (
+    id serial primary key,
+    user_id integer not null,
+    name character varying not null,
+    slug character varying not null unique,
+    is_public boolean not null default false,
+    is_default boolean not null default false,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+create index if not exists lists_user_id_idx on lists (user_id);
+
+create unique index if not exists lists_one_default_per_user_idx on lists (user_id) where is_default;
+
+create table if not exists list_movies (
+    id serial primary key,
+    list_id integer not null references lists (id) on delete cascade,
+    movie_id integer not null references movies (id) on delete cascade,
+    position integer not null,
+    created_at timestamp without time zone not null default now(),
+    unique (list_id, movie_id)
+);
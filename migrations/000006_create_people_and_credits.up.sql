@@ -0,0 +1,23 @@
+-- people who worked on movies and what they did on each one
+create table if not exists people (
+    id serial primary key,
+    name character varying not null,
+    birth_date date,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+create index if not exists people_name_idx on people (name);
+
+create table if not exists movie_credits (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    person_id integer not null references people (id) on delete cascade,
+    role character varying not null check (role in ('actor', 'director', 'writer')),
+    character_name character varying not null default '',
+    billing_order integer not null default 0,
+    created_at timestamp without time zone not null default now()
+);
+
+create index if not exists movie_credits_movie_id_idx on movie_credits (movie_id);
+create index if not exists movie_credits_person_id_idx on movie_credits (person_id);
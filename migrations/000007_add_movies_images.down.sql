@@ -0,0 +1,2 @@
+alter table movies drop column if exists backdrop_key;
+alter table movies drop column if exists poster_key;
@@ -0,0 +1,3 @@
+-- storage keys of the original poster and backdrop. thumbnails are stored next to them
+alter table movies add column if not exists poster_key character varying not null default '';
+alter table movies add column if not exists backdrop_key character varying not null default '';
@@ -0,0 +1,8 @@
+-- users used to be a single hard coded user in the api.Accounts are made with the user command now, see runCommand
+create table if not exists users (
+    id serial primary key,
+    email character varying not null unique,
+    password character varying not null,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
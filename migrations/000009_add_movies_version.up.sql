@@ -0,0 +1,2 @@
+-- version goes up with every update of a movie so clients can tell if what they have is still current
+alter table movies add column if not exists version integer not null default 1;
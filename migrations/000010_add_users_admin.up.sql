@@ -0,0 +1,3 @@
+-- only admins can moderate reviews.Databases that had the old hard coded account, id 10, had it as their one admin
+alter table users add column if not exists is_admin boolean not null default false;
+update users set is_admin = true where id = 10;
@@ -0,0 +1 @@
+-- the old password isn't put back
@@ -0,0 +1,4 @@
+-- 000008 used to add the old hard coded account with a password everyone could look up.Databases that got it keep the
+-- user, so its lists stay where they are, but the password is cleared so nobody can sign in with it.
+-- Give it a new password with the user command
+update users set password = '' where id = 10 and password = '$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK';
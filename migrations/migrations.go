@@ -0,0 +1,10 @@
+//Package migrations holds the database schema as numbered up and down sql files.
+//They are written for postgres, models.Migrate adapts them when the database is sqlite
+package migrations
+
+import "embed"
+
+//FS has every migration file
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,163 @@
+package models_test
+
+import (
+	"backend/models"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	c := models.NewLRUCache(2)
+
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	c.Set(ctx, "b", []byte("2"), time.Minute)
+	//reading a makes b the least recently used one
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("3"), time.Minute)
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b should have been pushed out")
+	}
+	if v, ok, _ := c.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Errorf("expected a to be kept, got %q %v", v, ok)
+	}
+
+	c.Set(ctx, "short", []byte("4"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := c.Get(ctx, "short"); ok {
+		t.Error("an expired entry should be a miss")
+	}
+
+	c.Clear(ctx)
+	if c.Len() != 0 {
+		t.Errorf("expected an empty cache, got %d entries", c.Len())
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+
+	c, err := models.NewRedisCache("redis://"+server.Addr(), "movies:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Set("other", "kept")
+
+	c.Set(ctx, "a", []byte("1"), time.Minute)
+	if v, ok, err := c.Get(ctx, "a"); err != nil || !ok || string(v) != "1" {
+		t.Fatalf("expected a hit, got %q %v %v", v, ok, err)
+	}
+
+	server.FastForward(2 * time.Minute)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Error("an expired entry should be a miss")
+	}
+
+	c.Set(ctx, "b", []byte("2"), time.Minute)
+	err = c.Clear(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b should have been cleared")
+	}
+	if !server.Exists("other") {
+		t.Error("Clear should only delete keys with the prefix")
+	}
+
+	//a cache that is down is a miss, not an error for the caller
+	server.Close()
+	m := models.NewMemoryModel()
+	id := m.AddGenre("Drama")
+	cached := models.NewCachedModels(models.NewMemoryModels(m), c, time.Minute)
+	genres, err := cached.Genres.GenreAll(ctx)
+	if err != nil || len(genres) != 1 || id == 0 {
+		t.Errorf("expected the genres from the models, got %v %v", genres, err)
+	}
+}
+
+func TestCachedModels(t *testing.T) {
+	ctx := context.Background()
+
+	caches := map[string]func(t *testing.T) models.Cache{
+		"lru": func(t *testing.T) models.Cache { return models.NewLRUCache(100) },
+		"redis": func(t *testing.T) models.Cache {
+			c, err := models.NewRedisCache("redis://"+miniredis.RunT(t).Addr(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		},
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			mem := models.NewMemoryModel()
+			raw := models.NewMemoryModels(mem)
+			m := models.NewCachedModels(raw, newCache(t), time.Minute)
+
+			now := time.Now()
+			movie := &models.Movie{Title: "Alien", ReleaseDate: models.NewDate(now), Created_At: now, Updated_At: now}
+			err := m.Movies.InsertMovie(ctx, movie)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := m.Movies.Get(ctx, movie.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all, err := m.Movies.All(ctx)
+			if err != nil || len(all) != 1 {
+				t.Fatalf("expected one movie, got %v %v", all, err)
+			}
+
+			//changed behind the cache's back, so the cached copy is still served
+			changed := *got
+			changed.Title = "Aliens"
+			err = raw.Movies.UpdateMovie(ctx, &changed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ = m.Movies.Get(ctx, movie.ID)
+			if got.Title != "Alien" || got.Created_At.IsZero() || got.Cast == nil {
+				t.Errorf("expected the cached movie, got %+v", got)
+			}
+			all, _ = m.Movies.All(ctx)
+			if all[0].Title != "Alien" {
+				t.Errorf("expected the cached list, got %q", all[0].Title)
+			}
+
+			//a write through the cached models clears it
+			changed.Title = "Alien 3"
+			err = m.Movies.UpdateMovie(ctx, &changed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ = m.Movies.Get(ctx, movie.ID)
+			all, _ = m.Movies.All(ctx)
+			if got.Title != "Alien 3" || all[0].Title != "Alien 3" {
+				t.Errorf("expected the update, got %q and %q", got.Title, all[0].Title)
+			}
+
+			//and so does a transaction
+			genres, _ := m.Genres.GenreAll(ctx)
+			mem.AddGenre("Horror")
+			err = m.WithTx(ctx, func(tx models.Models) error {
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, _ := m.Genres.GenreAll(ctx)
+			if len(after) != len(genres)+1 {
+				t.Errorf("expected the new genre after the transaction, got %d genres", len(after))
+			}
+		})
+	}
+}
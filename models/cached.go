@@ -0,0 +1,225 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"time"
+)
+
+//NewCachedModels puts cache in front of the movie and genre lookups of m.Get, All and GenreAll are read through
+//the cache, and every write that can change what they return clears it.Transactions and everything else go straight to m.
+//A lookup that started before a write can still cache what it read after the write cleared the cache, ttl is how
+//long such a stale entry can live at most
+func NewCachedModels(m Models, cache Cache, ttl time.Duration) Models {
+	c := &catalogueCache{cache: cache, ttl: ttl}
+	return Models{
+		Transactor: cachedTransactor{Transactor: m.Transactor, c: c},
+		Movies:     cachedMovies{MovieRepository: m.Movies, c: c},
+		Genres:     cachedGenres{GenreRepository: m.Genres, c: c},
+		Users:      m.Users,
+		Reviews:    cachedReviews{ReviewRepository: m.Reviews, c: c},
+		Lists:      m.Lists,
+		People:     cachedPeople{PersonRepository: m.People, c: c},
+	}
+}
+
+//catalogueCache reads and writes the cached lookups.A cache that fails is treated as a miss, the database still has the answer
+type catalogueCache struct {
+	cache Cache
+	ttl   time.Duration
+}
+
+//get decodes the value of key into v and reports whether it was there.Values are gob encoded so the fields json leaves out
+//(timestamps and image keys) survive, and every hit is a copy the caller is free to change
+func (c *catalogueCache) get(ctx context.Context, key string, v interface{}) bool {
+	value, ok, err := c.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return false
+	}
+	return gob.NewDecoder(bytes.NewReader(value)).Decode(v) == nil
+}
+
+func (c *catalogueCache) set(ctx context.Context, key string, v interface{}) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return
+	}
+	c.cache.Set(ctx, key, buf.Bytes(), c.ttl)
+}
+
+//invalidate clears the cache after a write.The write already happened, so if clearing fails the ttl has to do.
+//It doesn't use the request's context, a client going away mustn't leave the old data in the cache
+func (c *catalogueCache) invalidate() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.cache.Clear(ctx)
+}
+
+//gob leaves out empty maps and slices, the repositories return them empty and not nil
+func normalizeMovie(movie *Movie) {
+	if movie.MovieGenre == nil {
+		movie.MovieGenre = map[int]string{}
+	}
+	if movie.Cast == nil {
+		movie.Cast = []*Credit{}
+	}
+	if movie.Crew == nil {
+		movie.Crew = []*Credit{}
+	}
+}
+
+//cachedMovies reads movies through the cache
+type cachedMovies struct {
+	MovieRepository
+	c *catalogueCache
+}
+
+func (r cachedMovies) Get(ctx context.Context, id int) (*Movie, error) {
+	key := fmt.Sprintf("movie:%d", id)
+
+	var movie Movie
+	if r.c.get(ctx, key, &movie) {
+		normalizeMovie(&movie)
+		return &movie, nil
+	}
+
+	m, err := r.MovieRepository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.c.set(ctx, key, m)
+	return m, nil
+}
+
+//cachedMovieList wraps a list for gob, which can't encode a nil slice on its own
+type cachedMovieList struct {
+	Movies []*Movie
+}
+
+func (r cachedMovies) All(ctx context.Context, genre ...int) ([]*Movie, error) {
+	key := "movies"
+	if len(genre) > 0 {
+		key = fmt.Sprintf("movies:genre:%d", genre[0])
+	}
+
+	var cached cachedMovieList
+	if r.c.get(ctx, key, &cached) {
+		for _, movie := range cached.Movies {
+			normalizeMovie(movie)
+		}
+		return cached.Movies, nil
+	}
+
+	movies, err := r.MovieRepository.All(ctx, genre...)
+	if err != nil {
+		return nil, err
+	}
+	r.c.set(ctx, key, cachedMovieList{Movies: movies})
+	return movies, nil
+}
+
+func (r cachedMovies) InsertMovie(ctx context.Context, movie *Movie) error {
+	defer r.c.invalidate()
+	return r.MovieRepository.InsertMovie(ctx, movie)
+}
+
+func (r cachedMovies) UpdateMovie(ctx context.Context, movie *Movie) error {
+	defer r.c.invalidate()
+	return r.MovieRepository.UpdateMovie(ctx, movie)
+}
+
+func (r cachedMovies) DeleteMovieDb(ctx context.Context, id int) error {
+	defer r.c.invalidate()
+	return r.MovieRepository.DeleteMovieDb(ctx, id)
+}
+
+func (r cachedMovies) RestoreMovie(ctx context.Context, id int) error {
+	defer r.c.invalidate()
+	return r.MovieRepository.RestoreMovie(ctx, id)
+}
+
+func (r cachedMovies) PurgeMovies(ctx context.Context, before time.Time) (int64, error) {
+	defer r.c.invalidate()
+	return r.MovieRepository.PurgeMovies(ctx, before)
+}
+
+func (r cachedMovies) SetMovieImage(ctx context.Context, movieID int, kind, key string) (string, error) {
+	defer r.c.invalidate()
+	return r.MovieRepository.SetMovieImage(ctx, movieID, kind, key)
+}
+
+func (r cachedMovies) ImportMovies(ctx context.Context, rows []ImportRow, dryRun bool) ([]ImportResult, bool, error) {
+	defer r.c.invalidate()
+	return r.MovieRepository.ImportMovies(ctx, rows, dryRun)
+}
+
+//cachedGenres reads the genre list through the cache
+type cachedGenres struct {
+	GenreRepository
+	c *catalogueCache
+}
+
+type cachedGenreList struct {
+	Genres []*Genre
+}
+
+func (r cachedGenres) GenreAll(ctx context.Context) ([]*Genre, error) {
+	var cached cachedGenreList
+	if r.c.get(ctx, "genres", &cached) {
+		return cached.Genres, nil
+	}
+
+	genres, err := r.GenreRepository.GenreAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.c.set(ctx, "genres", cachedGenreList{Genres: genres})
+	return genres, nil
+}
+
+//cachedReviews clears the cache when reviews change, the movies carry their average rating
+type cachedReviews struct {
+	ReviewRepository
+	c *catalogueCache
+}
+
+func (r cachedReviews) SaveReview(ctx context.Context, review Review) error {
+	defer r.c.invalidate()
+	return r.ReviewRepository.SaveReview(ctx, review)
+}
+
+func (r cachedReviews) HideReview(ctx context.Context, id int, hidden bool) error {
+	defer r.c.invalidate()
+	return r.ReviewRepository.HideReview(ctx, id, hidden)
+}
+
+func (r cachedReviews) DeleteReview(ctx context.Context, id int) error {
+	defer r.c.invalidate()
+	return r.ReviewRepository.DeleteReview(ctx, id)
+}
+
+//cachedPeople clears the cache when credits change, the movies carry their cast and crew
+type cachedPeople struct {
+	PersonRepository
+	c *catalogueCache
+}
+
+func (r cachedPeople) SetMovieCredits(ctx context.Context, movieID int, credits []*Credit) error {
+	defer r.c.invalidate()
+	return r.PersonRepository.SetMovieCredits(ctx, movieID, credits)
+}
+
+//cachedTransactor clears the cache once a transaction is over.The Models inside it aren't cached so it never reads
+//what it hasn't committed yet from the cache, or puts it there
+type cachedTransactor struct {
+	Transactor
+	c *catalogueCache
+}
+
+func (t cachedTransactor) WithTx(ctx context.Context, fn func(tx Models) error) error {
+	defer t.c.invalidate()
+	return t.Transactor.WithTx(ctx, fn)
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+//Dialect is the sql flavour of the database behind a DBModel.Queries are written for postgres and
+//only the few bits sqlite does differently go through the dialect
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+//stringAgg joins the values of expr with sep.Postgres calls it string_agg, sqlite group_concat.
+//Neither order is guaranteed so callers sort the result themselves
+func (d Dialect) stringAgg(expr, sep string) string {
+	if d == SQLite {
+		return fmt.Sprintf("group_concat(%s, %s)", expr, sep)
+	}
+	return fmt.Sprintf("string_agg(%s, %s)", expr, sep)
+}
+
+//char is the sql for the character with code n.Postgres calls it chr, sqlite char
+func (d Dialect) char(n int) string {
+	if d == SQLite {
+		return fmt.Sprintf("char(%d)", n)
+	}
+	return fmt.Sprintf("chr(%d)", n)
+}
+
+//OpenSQLite opens the sqlite database in the file at path, creating it when it doesn't exist.
+//":memory:" gives a database that only lives as long as the returned pool
+func OpenSQLite(path string) (*sql.DB, error) {
+	//foreign keys are off by default in sqlite and the schema needs them for on delete cascade.
+	//immediate transactions take the write lock up front instead of failing half way when another connection writes
+	params := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+	if path != ":memory:" {
+		params += "&_pragma=journal_mode(wal)"
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params)
+	if err != nil {
+		return nil, err
+	}
+
+	//every connection to :memory: would get its own empty database
+	if path == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
+	return db, nil
+}
+
+//sqliteSchema rewrites the postgres only parts of a migration so the same files work on sqlite
+var sqliteSchema = strings.NewReplacer(
+	//an integer primary key is sqlite's auto increment
+	"serial primary key", "integer primary key",
+	//the driver only turns columns declared as plain timestamp into time.Time
+	"timestamp without time zone", "timestamp",
+	"default now()", "default current_timestamp",
+	//sqlite has no if not exists for columns.The migration version keeps them from running twice anyway
+	"add column if not exists", "add column",
+)
+
+//sequenceStatement matches statements that move a postgres sequence.Sqlite picks the next id from max(id) by itself
+var sequenceStatement = regexp.MustCompile(`(?i)\bsetval\s*\(`)
+
+//statements splits a migration into its statements in the form the dialect runs them.Postgres gets the whole
+//migration in one go, lib/pq runs it as one simple query, so semicolons in strings and $$ function bodies are fine.
+//Sqlite needs the setval statements taken out, so there it is split, on the semicolons outside of strings and comments
+func (d Dialect) statements(migration string) []string {
+	if d != SQLite {
+		if isBlank(migration) {
+			return nil
+		}
+		return []string{migration}
+	}
+
+	var stmts []string
+	for _, stmt := range splitStatements(migration) {
+		if isBlank(stmt) || sequenceStatement.MatchString(stmt) {
+			continue
+		}
+		stmts = append(stmts, sqliteSchema.Replace(stmt))
+	}
+	return stmts
+}
+
+//splitStatements cuts sql at the semicolons that end statements, the ones in 'strings', "identifiers" and -- comments stay
+func splitStatements(sql string) []string {
+	var stmts []string
+	start := 0
+	//the quote we are in, 0 outside of quotes
+	var quote byte
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			//a doubled quote is an escaped one and the check below sees it as leaving and coming back in
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end
+			}
+		case c == ';':
+			stmts = append(stmts, sql[start:i])
+			start = i + 1
+		}
+	}
+	return append(stmts, sql[start:])
+}
+
+//isBlank reports if stmt is only whitespace and -- comments
+func isBlank(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
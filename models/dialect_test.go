@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+//a migration with semicolons that don't end a statement
+const trickyMigration = `create table notes (
+  id serial primary key,
+  -- a comment; with a semicolon
+  body text not null default ';',
+  "odd;name" text default 'it''s; fine'
+);
+select setval('notes_id_seq', 1);
+insert into notes (body) values ('a;b');
+`
+
+func TestStatements(t *testing.T) {
+	if got := Postgres.statements(trickyMigration); !reflect.DeepEqual(got, []string{trickyMigration}) {
+		t.Errorf("postgres should get the migration in one piece, got %q", got)
+	}
+
+	got := SQLite.statements(trickyMigration)
+	if len(got) != 2 {
+		t.Fatalf("expected the create and the insert, got %q", got)
+	}
+	if got[1] != "\ninsert into notes (body) values ('a;b')" {
+		t.Errorf("unexpected insert %q", got[1])
+	}
+}
+
+func TestMigrateKeepsSemicolonsInStrings(t *testing.T) {
+	db, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	files := fstest.MapFS{"000001_notes.up.sql": {Data: []byte(trickyMigration)}}
+	_, err = Migrate(context.Background(), db, SQLite, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body, odd string
+	err = db.QueryRow(`select body, "odd;name" from notes`).Scan(&body, &odd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "a;b" || odd != "it's; fine" {
+		t.Errorf("unexpected row %q %q", body, odd)
+	}
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+//EachMovie calls fn for every movie matching the filter, ordered by id, together with its genre names.
+//Rows are read from the database cursor one at a time so the whole catalogue is never in memory.
+//Returning an error from fn stops it and EachMovie returns that error
+func (m *DBModel) EachMovie(ctx context.Context, filter MovieFilter, fn func(movie *Movie, genres []string) error) error {
+	//exports can take a while on a big catalogue
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	//genres come as one string so we don't need a query per movie.They are separated by the ascii unit separator,
+	//which unlike | or , can't be in a genre name someone typed
+	b := selectFrom("movies", `id, title, description, year, release_date, rating, runtime, mpaa_rating, created_at, updated_at,
+	coalesce((select `+m.Dialect.stringAgg("g.genre_name", m.Dialect.char(31))+` from movies_genres mg
+		join genres g on (g.id = mg.genre_id) where mg.movie_id = movies.id), '')`)
+	filter.where(b)
+	query, args := b.orderBy("id").build()
+
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+		var genreNames string
+		err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.Description,
+			&movie.Year,
+			&movie.ReleaseDate,
+			&movie.Rating,
+			&movie.Runtime,
+			&movie.MPAARating,
+			&movie.Created_At,
+			&movie.Updated_At,
+			&genreNames,
+		)
+		if err != nil {
+			return err
+		}
+
+		genres := []string{}
+		if genreNames != "" {
+			genres = strings.Split(genreNames, "\x1f")
+			sort.Strings(genres)
+		}
+
+		err = fn(&movie, genres)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
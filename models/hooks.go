@@ -0,0 +1,129 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+//QueryEvent is one query the DBModel ran
+type QueryEvent struct {
+	//the registered name of the query, or its table and verb for queries built on the fly
+	Name     string
+	Query    string
+	Args     []interface{}
+	Duration time.Duration
+	Err      error
+}
+
+//QueryHook is told about every query after it ran.It is called on the goroutine that ran the query so it has to be quick
+type QueryHook interface {
+	AfterQuery(ctx context.Context, e QueryEvent)
+}
+
+//QueryHooks calls every hook in order
+type QueryHooks []QueryHook
+
+func (hooks QueryHooks) AfterQuery(ctx context.Context, e QueryEvent) {
+	for _, hook := range hooks {
+		hook.AfterQuery(ctx, e)
+	}
+}
+
+//SlowQueryLog logs the queries that take longer than Threshold
+type SlowQueryLog struct {
+	Logger    *log.Logger
+	Threshold time.Duration
+}
+
+func (l SlowQueryLog) AfterQuery(ctx context.Context, e QueryEvent) {
+	if e.Duration < l.Threshold {
+		return
+	}
+
+	msg := fmt.Sprintf("slow query %s took %s: %s args=%s", e.Name, e.Duration.Round(time.Microsecond),
+		strings.Join(strings.Fields(e.Query), " "), SanitizeArgs(e.Args))
+	if e.Err != nil {
+		msg += " err=" + e.Err.Error()
+	}
+	l.Logger.Println(msg)
+}
+
+//SanitizeArgs formats query args for the logs.Strings and bytes can be emails, password hashes or review
+//texts so only their length is shown, numbers, bools and times are shown as they are
+func SanitizeArgs(args []interface{}) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			parts[i] = "null"
+		case string:
+			parts[i] = fmt.Sprintf("<%d chars>", len(v))
+		case []byte:
+			parts[i] = fmt.Sprintf("<%d bytes>", len(v))
+		case time.Time:
+			parts[i] = v.Format(time.RFC3339)
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+			parts[i] = fmt.Sprint(v)
+		default:
+			parts[i] = fmt.Sprintf("<%T>", v)
+		}
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+//QueryStats is the latency of one query since the start
+type QueryStats struct {
+	Count   int64   `json:"count"`
+	Errors  int64   `json:"errors"`
+	TotalMS float64 `json:"total_ms"`
+	AvgMS   float64 `json:"avg_ms"`
+	MaxMS   float64 `json:"max_ms"`
+}
+
+//QueryMetrics counts the queries and their latency by name.The zero value is ready to use
+type QueryMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*QueryStats
+}
+
+func (qm *QueryMetrics) AfterQuery(ctx context.Context, e QueryEvent) {
+	ms := float64(e.Duration) / float64(time.Millisecond)
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if qm.stats == nil {
+		qm.stats = make(map[string]*QueryStats)
+	}
+	s, ok := qm.stats[e.Name]
+	if !ok {
+		s = &QueryStats{}
+		qm.stats[e.Name] = s
+	}
+	s.Count++
+	if e.Err != nil {
+		s.Errors++
+	}
+	s.TotalMS += ms
+	if ms > s.MaxMS {
+		s.MaxMS = ms
+	}
+}
+
+//Snapshot returns a copy of the stats keyed by query name
+func (qm *QueryMetrics) Snapshot() map[string]QueryStats {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	snapshot := make(map[string]QueryStats, len(qm.stats))
+	for name, s := range qm.stats {
+		stats := *s
+		stats.AvgMS = stats.TotalMS / float64(stats.Count)
+		snapshot[name] = stats
+	}
+	return snapshot
+}
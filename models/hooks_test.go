@@ -0,0 +1,79 @@
+package models_test
+
+import (
+	"backend/migrations"
+	"backend/models"
+	"bytes"
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQueryHooks(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := models.OpenSQLite(filepath.Join(t.TempDir(), "movies.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = models.Migrate(ctx, db, models.SQLite, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	metrics := &models.QueryMetrics{}
+	m, err := models.NewModels(ctx, db, models.Config{
+		Dialect: models.SQLite,
+		//every query counts as slow
+		Hook: models.QueryHooks{models.SlowQueryLog{Logger: log.New(&logs, "", 0)}, metrics},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//inside a transaction the prepared statements are bound to it
+	err = m.WithTx(ctx, func(tx models.Models) error {
+		insert(ctx, t, tx, "Secret Title")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert(ctx, t, m, "Another Title")
+
+	_, err = m.Users.GetUserByEmail(ctx, "nobody@example.com")
+	if err == nil {
+		t.Fatal("expected no user")
+	}
+
+	stats := metrics.Snapshot()
+	if got := stats["movies.insert"]; got.Count != 2 || got.Errors != 0 || got.AvgMS <= 0 {
+		t.Errorf("unexpected movies.insert stats %+v", got)
+	}
+	//no rows is not an error of the query itself
+	if got := stats["users.by_email"]; got.Count != 1 || got.Errors != 0 {
+		t.Errorf("unexpected users.by_email stats %+v", got)
+	}
+
+	if !strings.Contains(logs.String(), "slow query movies.insert took") {
+		t.Errorf("expected the insert in the slow query log, got %q", logs.String())
+	}
+	for _, secret := range []string{"Secret Title", "nobody@example.com"} {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("the slow query log shows the argument %q", secret)
+		}
+	}
+}
+
+func TestSanitizeArgs(t *testing.T) {
+	got := models.SanitizeArgs([]interface{}{42, "hunter2", []byte("hash"), true, nil})
+	want := "[42 <7 chars> <4 bytes> true null]"
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
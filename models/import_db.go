@@ -0,0 +1,194 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//statuses of a row in an import report
+const (
+	ImportCreated = "created"
+	ImportUpdated = "updated"
+	ImportFailed  = "failed"
+)
+
+//ImportRow is one movie from an import file.Err is set when the row couldn't even be read, then it isn't saved
+type ImportRow struct {
+	Row    int
+	Movie  Movie
+	Genres []string
+	Err    error
+}
+
+//ImportResult says what happened to one row of an import
+type ImportResult struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+var genreNamesQuery = register("genres.names", `select id, genre_name from genres`)
+
+//ImportMovies saves the rows in one transaction.Rows with an id update that movie, the rest are inserted.
+//Every row gets its own savepoint so one bad row doesn't stop the others from being checked.
+//Nothing is committed if a row failed or dryRun is set, and the returned bool says whether it was
+func (m *DBModel) ImportMovies(ctx context.Context, rows []ImportRow, dryRun bool) ([]ImportResult, bool, error) {
+	//imports can be big so they get more time than a normal query
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	var results []ImportResult
+	committed := false
+
+	err := m.transaction(ctx, func(tx *DBModel) error {
+		//genres are matched by name without caring about case
+		genreIDs := make(map[string]int)
+		genreRows, err := tx.db().QueryContext(ctx, genreNamesQuery)
+		if err != nil {
+			return err
+		}
+		for genreRows.Next() {
+			var id int
+			var name string
+			err = genreRows.Scan(&id, &name)
+			if err != nil {
+				genreRows.Close()
+				return err
+			}
+			genreIDs[strings.ToLower(name)] = id
+		}
+		genreRows.Close()
+		if err = genreRows.Err(); err != nil {
+			return err
+		}
+
+		//a retried transaction starts the report over
+		results = make([]ImportResult, 0, len(rows))
+		committed = false
+		failed := 0
+
+		for _, row := range rows {
+			result := ImportResult{Row: row.Row, Title: row.Movie.Title}
+
+			err := row.Err
+			if err == nil {
+				result.ID, result.Status, err = importRow(ctx, tx.db(), row, genreIDs)
+			}
+			if err != nil {
+				result.ID = 0
+				result.Status = ImportFailed
+				result.Error = err.Error()
+				failed++
+			}
+
+			results = append(results, result)
+		}
+
+		if dryRun || failed > 0 {
+			return errRollback
+		}
+		committed = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return results, committed, nil
+}
+
+//importRow saves one row inside its own savepoint and says whether it was created or updated
+func importRow(ctx context.Context, tx querier, row ImportRow, genreIDs map[string]int) (int, string, error) {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, name := range row.Genres {
+		id, ok := genreIDs[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return 0, "", fmt.Errorf("unknown genre %q", name)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `savepoint import_row`)
+	if err != nil {
+		return 0, "", err
+	}
+
+	id, status, err := saveImportedMovie(ctx, tx, row.Movie, ids, row.Genres != nil)
+	if err != nil {
+		//undo only this row.If even that fails the transaction is broken and the error from it is the one to report
+		_, rollbackErr := tx.ExecContext(ctx, `rollback to savepoint import_row`)
+		if rollbackErr != nil {
+			return 0, "", rollbackErr
+		}
+		return 0, "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `release savepoint import_row`)
+	return id, status, err
+}
+
+var movieExistsQuery = register("movies.exists", `select exists (select 1 from movies where id = $1 and deleted_at is null)`)
+
+func saveImportedMovie(ctx context.Context, tx querier, movie Movie, genreIDs []int, setGenres bool) (int, string, error) {
+	status := ImportCreated
+
+	if movie.ID == 0 {
+		err := insertMovie(ctx, tx, &movie)
+		if err != nil {
+			return 0, "", err
+		}
+	} else {
+		var exists bool
+		err := tx.QueryRowContext(ctx, movieExistsQuery, movie.ID).Scan(&exists)
+		if err != nil {
+			return 0, "", err
+		}
+		if !exists {
+			return 0, "", errors.New("movie not found")
+		}
+
+		err = updateMovie(ctx, tx, &movie)
+		if err != nil {
+			return 0, "", err
+		}
+		status = ImportUpdated
+	}
+
+	if setGenres {
+		err := setMovieGenres(ctx, tx, movie.ID, genreIDs)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	return movie.ID, status, nil
+}
+
+var deleteMovieGenresQuery = register("movies_genres.delete", `delete from movies_genres where movie_id = $1`)
+
+var insertMovieGenreQuery = register("movies_genres.insert", `insert into movies_genres (movie_id, genre_id, created_at, updated_at) values ($1, $2, $3, $3)`)
+
+//setMovieGenres replaces the genres of a movie
+func setMovieGenres(ctx context.Context, q querier, movieID int, genreIDs []int) error {
+	_, err := q.ExecContext(ctx, deleteMovieGenresQuery, movieID)
+	if err != nil {
+		return err
+	}
+
+	for _, genreID := range genreIDs {
+		_, err = q.ExecContext(ctx, insertMovieGenreQuery,
+			movieID, genreID, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+//ErrListMovies is returned by ReorderList when the ids don't match the movies in the list
+var ErrListMovies = errors.New("movie_ids must contain every movie in the list exactly once")
+
+//newSlug makes a url friendly slug from the list name with a random part so two lists never share one
+func newSlug(name string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteRune('-')
+		}
+	}
+	base := strings.Trim(b.String(), "-")
+	if len(base) > 40 {
+		base = strings.Trim(base[:40], "-")
+	}
+
+	random := make([]byte, 4)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	if base == "" {
+		return hex.EncodeToString(random), nil
+	}
+	return base + "-" + hex.EncodeToString(random), nil
+}
+
+//listColumns is what we select for a list
+const listColumns = `id, user_id, name, slug, is_public, is_default, created_at, updated_at`
+
+func scanList(row interface{ Scan(...interface{}) error }) (*List, error) {
+	var l List
+	err := row.Scan(
+		&l.ID,
+		&l.UserID,
+		&l.Name,
+		&l.Slug,
+		&l.Public,
+		&l.Default,
+		&l.Created_At,
+		&l.Updated_At,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+var insertFavouritesQuery = register("lists.insert_favourites", `insert into lists (user_id, name, slug, is_public, is_default, created_at, updated_at)
+	values ($1, $2, $3, false, true, $4, $4) on conflict (user_id) where is_default do nothing`)
+
+var userListsQuery = register("lists.by_user", `select `+listColumns+` from lists where user_id = $1 order by is_default desc, created_at, id`)
+
+//UserLists returns all lists of a user, the favourites list first.The favourites list is created the first time a user asks for their lists
+func (m *DBModel) UserLists(ctx context.Context, userID int) ([]*List, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	slug, err := newSlug(FavouritesListName)
+	if err != nil {
+		return nil, err
+	}
+
+	//does nothing if the user already has a default list
+	_, err = m.db().ExecContext(ctx, insertFavouritesQuery, userID, FavouritesListName, slug, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db().QueryContext(ctx, userListsQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []*List
+	for rows.Next() {
+		l, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+
+	return lists, rows.Err()
+}
+
+var getListQuery = register("lists.get", `select `+listColumns+` from lists where id = $1`)
+
+//GetList returns one list with its movies
+func (m *DBModel) GetList(ctx context.Context, id int) (*List, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	l, err := scanList(m.db().QueryRowContext(ctx, getListQuery, id))
+	if err != nil {
+		return nil, err
+	}
+
+	l.Movies, err = m.listMovies(ctx, l.ID)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+var listBySlugQuery = register("lists.by_slug", `select `+listColumns+` from lists where slug = $1`)
+
+//ListBySlug returns the list with the given slug and its movies
+func (m *DBModel) ListBySlug(ctx context.Context, slug string) (*List, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	l, err := scanList(m.db().QueryRowContext(ctx, listBySlugQuery, slug))
+	if err != nil {
+		return nil, err
+	}
+
+	l.Movies, err = m.listMovies(ctx, l.ID)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+var listMoviesQuery = register("list_movies.movies", `select movies.id, title, description, year, release_date, rating, runtime, mpaa_rating,
+	movies.created_at, updated_at, poster_key, backdrop_key, version, `+ratingColumns+`
+	from list_movies lm join movies on (movies.id = lm.movie_id)
+	where lm.list_id = $1 and movies.deleted_at is null order by lm.position`)
+
+//listMovies returns the movies of a list in the user's order.Movies in the trash are left out
+func (m *DBModel) listMovies(ctx context.Context, listID int) ([]*Movie, error) {
+	rows, err := m.db().QueryContext(ctx, listMoviesQuery, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.Description,
+			&movie.Year,
+			&movie.ReleaseDate,
+			&movie.Rating,
+			&movie.Runtime,
+			&movie.MPAARating,
+			&movie.Created_At,
+			&movie.Updated_At,
+			&movie.PosterKey,
+			&movie.BackdropKey,
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+	//we need to close the rows before running more queries on the same connection
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	//the genres of the whole list in one query
+	ids := make([]int, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	genres, err := m.GenresForMovies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, movie := range movies {
+		movie.MovieGenre = genreMap(genres[movie.ID])
+	}
+
+	return movies, nil
+}
+
+var insertListQuery = register("lists.insert", `insert into lists (user_id, name, slug, is_public, is_default, created_at, updated_at)
+	values ($1, $2, $3, $4, false, $5, $6) returning id`)
+
+//InsertList creates a new list and returns its id.The slug is made from the name
+func (m *DBModel) InsertList(ctx context.Context, list List) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	slug, err := newSlug(list.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = m.db().QueryRowContext(ctx, insertListQuery,
+		list.UserID,
+		list.Name,
+		slug,
+		list.Public,
+		list.Created_At,
+		list.Updated_At,
+	).Scan(&id)
+	return id, err
+}
+
+var updateListQuery = register("lists.update", `update lists set name = $1, is_public = $2, updated_at = $3 where id = $4`)
+
+//UpdateList renames a list and changes its visibility.The slug stays the same so shared links keep working
+func (m *DBModel) UpdateList(ctx context.Context, list List) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.db().ExecContext(ctx, updateListQuery, list.Name, list.Public, list.Updated_At, list.ID)
+	return err
+}
+
+var deleteListQuery = register("lists.delete", `delete from lists where id = $1`)
+
+//DeleteList deletes a list and its entries
+func (m *DBModel) DeleteList(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.db().ExecContext(ctx, deleteListQuery, id)
+	return err
+}
+
+var addListMovieQuery = register("list_movies.insert", `insert into list_movies (list_id, movie_id, position, created_at)
+	select $1, $2, coalesce(max(position), 0) + 1, $3 from list_movies where list_id = $1
+	on conflict (list_id, movie_id) do nothing`)
+
+//AddListMovie puts a movie at the end of a list.Adding a movie that is already in the list does nothing
+func (m *DBModel) AddListMovie(ctx context.Context, listID, movieID int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.db().ExecContext(ctx, addListMovieQuery, listID, movieID, time.Now())
+	return err
+}
+
+var removeListMovieQuery = register("list_movies.delete", `delete from list_movies where list_id = $1 and movie_id = $2`)
+
+//RemoveListMovie takes a movie out of a list
+func (m *DBModel) RemoveListMovie(ctx context.Context, listID, movieID int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, removeListMovieQuery, listID, movieID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+var countListMoviesQuery = register("list_movies.count", `select count(*) from list_movies lm join movies on (movies.id = lm.movie_id)
+	where lm.list_id = $1 and movies.deleted_at is null`)
+
+var moveListMovieQuery = register("list_movies.move", `update list_movies set position = $1 where list_id = $2 and movie_id = $3
+	and movie_id in (select id from movies where deleted_at is null)`)
+
+var moveTrashedListMoviesQuery = register("list_movies.move_trashed", `update list_movies set position = position + $1 where list_id = $2
+	and movie_id in (select id from movies where deleted_at is not null)`)
+
+//ReorderList puts the movies of a list in the order of movieIDs, which has to hold every movie of the list.
+//Movies in the trash are left out like listMovies leaves them out, they go after the others so a restored one is at the end
+func (m *DBModel) ReorderList(ctx context.Context, listID int, movieIDs []int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return m.transaction(ctx, func(tx *DBModel) error {
+		q := tx.db()
+
+		var count int
+		err := q.QueryRowContext(ctx, countListMoviesQuery, listID).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count != len(movieIDs) {
+			return ErrListMovies
+		}
+
+		seen := make(map[int]bool)
+		for i, movieID := range movieIDs {
+			if seen[movieID] {
+				return ErrListMovies
+			}
+			seen[movieID] = true
+
+			result, err := q.ExecContext(ctx, moveListMovieQuery, i+1, listID, movieID)
+			if err != nil {
+				return err
+			}
+
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrListMovies
+			}
+		}
+
+		//adding the count keeps the trashed ones in their order, behind the ones just moved
+		_, err = q.ExecContext(ctx, moveTrashedListMoviesQuery, len(movieIDs), listID)
+		return err
+	})
+}
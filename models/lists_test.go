@@ -0,0 +1,141 @@
+package models_test
+
+import (
+	"backend/migrations"
+	"backend/models"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func listIDs(ctx context.Context, t *testing.T, m models.Models, listID int) []int {
+	t.Helper()
+
+	list, err := m.Lists.GetList(ctx, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, movie := range list.Movies {
+		ids = append(ids, movie.ID)
+	}
+	return ids
+}
+
+//TestReorderListSkipsTrash checks that a list can be reordered with exactly the movies GetList shows
+func TestReorderListSkipsTrash(t *testing.T) {
+	ctx := context.Background()
+
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			listID, err := m.Lists.InsertList(ctx, models.List{UserID: 1, Name: "Watch", Created_At: now, Updated_At: now})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int
+			for _, title := range []string{"Alien", "Brazil", "Casablanca"} {
+				movie := &models.Movie{Title: title, ReleaseDate: models.NewDate(now), Created_At: now, Updated_At: now}
+				err := m.Movies.InsertMovie(ctx, movie)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = m.Lists.AddListMovie(ctx, listID, movie.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, movie.ID)
+			}
+			alien, brazil, casablanca := ids[0], ids[1], ids[2]
+
+			err = m.Movies.DeleteMovieDb(ctx, brazil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = m.Lists.ReorderList(ctx, listID, []int{casablanca, brazil})
+			if !errors.Is(err, models.ErrListMovies) {
+				t.Errorf("a trashed movie can't stand in for a shown one, got %v", err)
+			}
+			err = m.Lists.ReorderList(ctx, listID, []int{casablanca, alien})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := listIDs(ctx, t, m, listID); len(got) != 2 || got[0] != casablanca || got[1] != alien {
+				t.Errorf("expected Casablanca and Alien, got %v", got)
+			}
+
+			//a restored movie comes back at the end
+			err = m.Movies.RestoreMovie(ctx, brazil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := listIDs(ctx, t, m, listID); len(got) != 3 || got[0] != casablanca || got[1] != alien || got[2] != brazil {
+				t.Errorf("expected Casablanca, Alien and Brazil, got %v", got)
+			}
+		})
+	}
+}
+
+func TestListLoadsGenresAtOnce(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := models.OpenSQLite(filepath.Join(t.TempDir(), "movies.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = models.Migrate(ctx, db, models.SQLite, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := &models.QueryMetrics{}
+	m, err := models.NewModels(ctx, db, models.Config{Dialect: models.SQLite, Hook: metrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	listID, err := m.Lists.InsertList(ctx, models.List{UserID: 1, Name: "Watch", Created_At: now, Updated_At: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"Alien", "Brazil", "Casablanca"} {
+		insert(ctx, t, m, title)
+	}
+	movies, err := m.Movies.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, movie := range movies {
+		err = m.Lists.AddListMovie(ctx, listID, movie.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.Exec(`insert into genres (id, genre_name, created_at, updated_at) values (1, 'Horror', current_timestamp, current_timestamp)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`insert into movies_genres (movie_id, genre_id, created_at, updated_at) values ($1, 1, current_timestamp, current_timestamp)`, movies[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := metrics.Snapshot()
+	list, err := m.Lists.GetList(ctx, listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := metrics.Snapshot()
+	if got := after["movies_genres.select"].Count - before["movies_genres.select"].Count; got != 1 {
+		t.Errorf("expected one genres query, got %d", got)
+	}
+
+	if len(list.Movies) != 3 || list.Movies[0].MovieGenre[1] != "Horror" || len(list.Movies[1].MovieGenre) != 0 {
+		t.Errorf("unexpected list movies %+v", list.Movies)
+	}
+}
@@ -0,0 +1,1105 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//MemoryModel keeps everything in memory and does what DBModel does with postgres.It is for tests,
+//so the handlers can run without a database.Everything it returns is a copy, like rows read from postgres would be
+type MemoryModel struct {
+	mu sync.Mutex
+	//held by WithTx so transactions run one at a time
+	txMu sync.Mutex
+
+	//one counter for every id, ids never repeat
+	lastID int
+
+	movies      map[int]*Movie
+	genres      map[int]*Genre
+	movieGenres map[int][]int
+	revisions   map[int][]*MovieRevision
+	reviews     map[int]*Review
+	lists       map[int]*List
+	listMovies  map[int][]int
+	people      map[int]*Person
+	credits     map[int][]*Credit
+	users       map[int]*User
+}
+
+//NewMemoryModel returns an empty MemoryModel
+func NewMemoryModel() *MemoryModel {
+	return &MemoryModel{
+		movies:      make(map[int]*Movie),
+		genres:      make(map[int]*Genre),
+		movieGenres: make(map[int][]int),
+		revisions:   make(map[int][]*MovieRevision),
+		reviews:     make(map[int]*Review),
+		lists:       make(map[int]*List),
+		listMovies:  make(map[int][]int),
+		people:      make(map[int]*Person),
+		credits:     make(map[int][]*Credit),
+		users:       make(map[int]*User),
+	}
+}
+
+//NewMemoryModels returns Models with every repository backed by the same MemoryModel
+func NewMemoryModels(m *MemoryModel) Models {
+	return Models{
+		Transactor: m,
+		Movies:     m,
+		Genres:     m,
+		Users:      m,
+		Reviews:    m,
+		Lists:      m,
+		People:     m,
+	}
+}
+
+//WithTx runs fn and puts everything back the way it was when fn returns an error or panics.
+//Calls made outside the transaction while it runs aren't kept out, it is only meant for tests
+func (m *MemoryModel) WithTx(ctx context.Context, fn func(tx Models) error) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	return memoryTx{m}.WithTx(ctx, fn)
+}
+
+//memoryTx is the MemoryModel a WithTx func gets.Its own WithTx is nested so it doesn't wait for the outer one
+type memoryTx struct {
+	*MemoryModel
+}
+
+func (t memoryTx) WithTx(ctx context.Context, fn func(tx Models) error) error {
+	saved := t.snapshot()
+	defer func() {
+		if p := recover(); p != nil {
+			t.restore(saved)
+			panic(p)
+		}
+	}()
+
+	err := fn(Models{
+		Transactor: t,
+		Movies:     t,
+		Genres:     t,
+		Users:      t,
+		Reviews:    t,
+		Lists:      t,
+		People:     t,
+	})
+	if err != nil {
+		t.restore(saved)
+	}
+	return err
+}
+
+//memoryState is a copy of everything in a MemoryModel except lastID, ids used in a rolled back
+//transaction stay used like they would in a postgres sequence
+type memoryState struct {
+	movies      map[int]*Movie
+	genres      map[int]*Genre
+	movieGenres map[int][]int
+	revisions   map[int][]*MovieRevision
+	reviews     map[int]*Review
+	lists       map[int]*List
+	listMovies  map[int][]int
+	people      map[int]*Person
+	credits     map[int][]*Credit
+	users       map[int]*User
+}
+
+func (m *MemoryModel) snapshot() memoryState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return memoryState{
+		movies:      cloneRows(m.movies),
+		genres:      cloneRows(m.genres),
+		movieGenres: cloneLists(m.movieGenres, func(id int) int { return id }),
+		revisions:   cloneLists(m.revisions, cloneRow[MovieRevision]),
+		reviews:     cloneRows(m.reviews),
+		lists:       cloneRows(m.lists),
+		listMovies:  cloneLists(m.listMovies, func(id int) int { return id }),
+		people:      cloneRows(m.people),
+		credits:     cloneLists(m.credits, cloneRow[Credit]),
+		users:       cloneRows(m.users),
+	}
+}
+
+func (m *MemoryModel) restore(s memoryState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.movies, m.genres, m.movieGenres, m.revisions = s.movies, s.genres, s.movieGenres, s.revisions
+	m.reviews, m.lists, m.listMovies = s.reviews, s.lists, s.listMovies
+	m.people, m.credits, m.users = s.people, s.credits, s.users
+}
+
+func cloneRow[T any](row *T) *T {
+	c := *row
+	return &c
+}
+
+//cloneRows copies the map and what its values point to, so changing a stored row doesn't change the copy
+func cloneRows[T any](rows map[int]*T) map[int]*T {
+	c := make(map[int]*T, len(rows))
+	for id, row := range rows {
+		c[id] = cloneRow(row)
+	}
+	return c
+}
+
+func cloneLists[T any](lists map[int][]T, clone func(T) T) map[int][]T {
+	c := make(map[int][]T, len(lists))
+	for id, list := range lists {
+		c[id] = make([]T, len(list))
+		for i, v := range list {
+			c[id][i] = clone(v)
+		}
+	}
+	return c
+}
+
+func (m *MemoryModel) nextID() int {
+	m.lastID++
+	return m.lastID
+}
+
+//AddGenre adds a genre and returns its id.There is no api for genres so tests add them here
+func (m *MemoryModel) AddGenre(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextID()
+	now := time.Now()
+	m.genres[id] = &Genre{ID: id, GenreName: name, Created_At: now, Updated_At: now}
+	return id
+}
+
+//SetMovieGenres replaces the genres of a movie
+func (m *MemoryModel) SetMovieGenres(movieID int, genreIDs ...int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.movieGenres[movieID] = append([]int(nil), genreIDs...)
+}
+
+//AddUser adds a user and returns its id.Password has to be a bcrypt hash already
+func (m *MemoryModel) AddUser(user User) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user.ID = m.nextID()
+	m.users[user.ID] = &user
+	return user.ID
+}
+
+//movie returns a copy of a stored movie with its genres and ratings filled in, like the postgres queries do
+func (m *MemoryModel) movie(stored *Movie, withCredits bool) *Movie {
+	movie := *stored
+	movie.MovieGenre = make(map[int]string)
+	for _, id := range m.movieGenres[movie.ID] {
+		if g, ok := m.genres[id]; ok {
+			movie.MovieGenre[id] = g.GenreName
+		}
+	}
+
+	movie.AverageRating, movie.RatingCount = 0, 0
+	sum := 0
+	for _, r := range m.reviews {
+		if r.MovieID == movie.ID && !r.Hidden {
+			sum += r.Rating
+			movie.RatingCount++
+		}
+	}
+	if movie.RatingCount > 0 {
+		movie.AverageRating = float64(sum) / float64(movie.RatingCount)
+	}
+
+	movie.Cast, movie.Crew = nil, nil
+	if withCredits {
+		movie.Cast, movie.Crew = m.movieCredits(movie.ID)
+	}
+	return &movie
+}
+
+//live returns the movies that are not in the trash
+func (m *MemoryModel) live() []*Movie {
+	var movies []*Movie
+	for _, movie := range m.movies {
+		if movie.DeletedAt == nil {
+			movies = append(movies, movie)
+		}
+	}
+	return movies
+}
+
+func (f MovieFilter) matches(m *MemoryModel, movie *Movie) bool {
+	if f.GenreID > 0 {
+		found := false
+		for _, id := range m.movieGenres[movie.ID] {
+			if id == f.GenreID {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Title != "" && !strings.Contains(strings.ToLower(movie.Title), strings.ToLower(f.Title)) {
+		return false
+	}
+	return true
+}
+
+//compareMovies compares two movies on one of the movieSorts fields, like the order by of the listing queries
+func compareMovies(a, b *Movie, field string) int {
+	less, greater := false, false
+	switch field {
+	case "title":
+		less, greater = a.Title < b.Title, a.Title > b.Title
+	case "year":
+		less, greater = a.Year < b.Year, a.Year > b.Year
+	case "release_date":
+		less, greater = a.ReleaseDate.Before(b.ReleaseDate.Time), a.ReleaseDate.After(b.ReleaseDate.Time)
+	case "rating":
+		less, greater = a.Rating < b.Rating, a.Rating > b.Rating
+	case "runtime":
+		less, greater = a.Runtime < b.Runtime, a.Runtime > b.Runtime
+	}
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+//sortMovies orders movies the way the listing queries do for the sort of a MovieFilter
+func sortMovies(movies []*Movie, sortBy string) error {
+	if sortBy == "" {
+		sortBy = "title"
+	}
+	fields, err := parseSort(sortBy, movieSorts)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(movies, func(i, j int) bool {
+		for _, f := range fields {
+			c := compareMovies(movies[i], movies[j], f.name)
+			if f.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return movies[i].ID < movies[j].ID
+	})
+	return nil
+}
+
+func (m *MemoryModel) Get(ctx context.Context, id int) (*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[id]
+	if !ok || stored.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+	return m.movie(stored, true), nil
+}
+
+func (m *MemoryModel) All(ctx context.Context, genre ...int) ([]*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var filter MovieFilter
+	if len(genre) > 0 {
+		filter.GenreID = genre[0]
+	}
+
+	var movies []*Movie
+	for _, stored := range m.live() {
+		if filter.matches(m, stored) {
+			movies = append(movies, m.movie(stored, true))
+		}
+	}
+	err := sortMovies(movies, filter.Sort)
+	if err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+func (m *MemoryModel) ListMovies(ctx context.Context, filter MovieFilter, limit, offset int) ([]*Movie, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var matching []*Movie
+	for _, stored := range m.live() {
+		if filter.matches(m, stored) {
+			matching = append(matching, stored)
+		}
+	}
+	err := sortMovies(matching, filter.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	movies := []*Movie{}
+	for i := offset; i < len(matching) && i < offset+limit; i++ {
+		movie := m.movie(matching[i], false)
+		movie.MovieGenre = nil
+		movies = append(movies, movie)
+	}
+	return movies, len(matching), nil
+}
+
+func (m *MemoryModel) EachMovie(ctx context.Context, filter MovieFilter, fn func(movie *Movie, genres []string) error) error {
+	m.mu.Lock()
+	var movies []*Movie
+	var genres [][]string
+	for _, stored := range m.live() {
+		if !filter.matches(m, stored) {
+			continue
+		}
+		movie := *stored
+		names := []string{}
+		for _, id := range m.movieGenres[movie.ID] {
+			names = append(names, m.genres[id].GenreName)
+		}
+		sort.Strings(names)
+		movies = append(movies, &movie)
+		genres = append(genres, names)
+	}
+	//fn may be slow, so it runs without holding the lock
+	m.mu.Unlock()
+
+	order := make([]int, len(movies))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return movies[order[i]].ID < movies[order[j]].ID })
+
+	for _, i := range order {
+		err := fn(movies[i], genres[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryModel) InsertMovie(ctx context.Context, movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.insertMovie(*movie)
+	movie.ID, movie.Version = stored.ID, stored.Version
+	return nil
+}
+
+func (m *MemoryModel) insertMovie(movie Movie) *Movie {
+	movie.ID = m.nextID()
+	movie.Version = 1
+	movie.DeletedAt = nil
+	movie.PosterKey, movie.BackdropKey = "", ""
+	movie.MovieGenre, movie.Cast, movie.Crew = nil, nil, nil
+	m.movies[movie.ID] = &movie
+	return &movie
+}
+
+func (m *MemoryModel) UpdateMovie(ctx context.Context, movie *Movie) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.updateMovie(*movie)
+	if !ok {
+		return ErrNotFound
+	}
+
+	//what the update returns doesn't have genres, ratings or credits, like the postgres one
+	*movie = *stored
+	return nil
+}
+
+//updateMovie saves the changes and the revisions, see updateMovie in movies_db.go
+func (m *MemoryModel) updateMovie(movie Movie) (*Movie, bool) {
+	stored, ok := m.movies[movie.ID]
+	if !ok || stored.DeletedAt != nil {
+		return nil, false
+	}
+
+	if len(m.revisions[movie.ID]) == 0 {
+		m.addRevision(stored, stored.Updated_At)
+	}
+
+	stored.Title = movie.Title
+	stored.Description = movie.Description
+	stored.Year = movie.Year
+	stored.ReleaseDate = movie.ReleaseDate
+	stored.Runtime = movie.Runtime
+	stored.Rating = movie.Rating
+	stored.MPAARating = movie.MPAARating
+	stored.Updated_At = movie.Updated_At
+	stored.Version++
+
+	m.addRevision(stored, movie.Updated_At)
+	return stored, true
+}
+
+func (m *MemoryModel) addRevision(movie *Movie, at time.Time) {
+	revisions := m.revisions[movie.ID]
+	m.revisions[movie.ID] = append(revisions, &MovieRevision{
+		ID:          m.nextID(),
+		MovieID:     movie.ID,
+		Revision:    len(revisions) + 1,
+		Title:       movie.Title,
+		Description: movie.Description,
+		Year:        movie.Year,
+		ReleaseDate: movie.ReleaseDate,
+		Runtime:     movie.Runtime,
+		Rating:      movie.Rating,
+		MPAARating:  movie.MPAARating,
+		Created_At:  at,
+	})
+}
+
+func (m *MemoryModel) DeleteMovieDb(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[id]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	stored.DeletedAt = &now
+	stored.Updated_At = now
+	return nil
+}
+
+func (m *MemoryModel) DeletedMovies(ctx context.Context) ([]*Movie, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var movies []*Movie
+	for _, stored := range m.movies {
+		if stored.DeletedAt != nil {
+			movie := *stored
+			movies = append(movies, &movie)
+		}
+	}
+	sort.Slice(movies, func(i, j int) bool { return movies[i].DeletedAt.After(*movies[j].DeletedAt) })
+	return movies, nil
+}
+
+func (m *MemoryModel) RestoreMovie(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[id]
+	if !ok || stored.DeletedAt == nil {
+		return ErrNotFound
+	}
+	stored.DeletedAt = nil
+	stored.Updated_At = time.Now()
+	return nil
+}
+
+func (m *MemoryModel) PurgeMovies(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for id, stored := range m.movies {
+		if stored.DeletedAt != nil && stored.DeletedAt.Before(before) {
+			delete(m.movies, id)
+			delete(m.movieGenres, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryModel) LastModified(ctx context.Context) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var modified time.Time
+	for _, stored := range m.movies {
+		if stored.Updated_At.After(modified) {
+			modified = stored.Updated_At
+		}
+	}
+	return modified, nil
+}
+
+//touch moves the updated_at of a movie, see touchMovie in movies_db.go
+func (m *MemoryModel) touch(movieID int) {
+	if stored, ok := m.movies[movieID]; ok {
+		stored.Updated_At = time.Now()
+	}
+}
+
+func (m *MemoryModel) SetMovieImage(ctx context.Context, movieID int, kind, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.movies[movieID]
+	if !ok || stored.DeletedAt != nil {
+		return "", ErrNotFound
+	}
+
+	var field *string
+	switch kind {
+	case "poster":
+		field = &stored.PosterKey
+	case "backdrop":
+		field = &stored.BackdropKey
+	default:
+		return "", fmt.Errorf("unknown image kind %q", kind)
+	}
+	old := *field
+	*field = key
+	stored.Updated_At = time.Now()
+	return old, nil
+}
+
+func (m *MemoryModel) MovieRevisions(ctx context.Context, movieID int) ([]*MovieRevision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var revisions []*MovieRevision
+	for _, stored := range m.revisions[movieID] {
+		r := *stored
+		r.Changes = []FieldChange{}
+		if len(revisions) > 0 {
+			r.Changes = r.Diff(revisions[len(revisions)-1])
+		}
+		revisions = append(revisions, &r)
+	}
+	return revisions, nil
+}
+
+func (m *MemoryModel) MovieRevision(ctx context.Context, movieID, revision int) (*MovieRevision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.revisions[movieID] {
+		if stored.Revision == revision {
+			r := *stored
+			return &r, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+//ImportMovies checks every row first and only saves them when none failed, which is what the transaction does in postgres
+func (m *MemoryModel) ImportMovies(ctx context.Context, rows []ImportRow, dryRun bool) ([]ImportResult, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	genreIDs := make(map[string]int)
+	for _, g := range m.genres {
+		genreIDs[strings.ToLower(g.GenreName)] = g.ID
+	}
+
+	results := make([]ImportResult, 0, len(rows))
+	rowGenres := make([][]int, len(rows))
+	failed := 0
+	nextID := m.lastID
+
+	for i, row := range rows {
+		result := ImportResult{Row: row.Row, Title: row.Movie.Title}
+
+		err := row.Err
+		if err == nil {
+			for _, name := range row.Genres {
+				id, ok := genreIDs[strings.ToLower(strings.TrimSpace(name))]
+				if !ok {
+					err = fmt.Errorf("unknown genre %q", name)
+					break
+				}
+				rowGenres[i] = append(rowGenres[i], id)
+			}
+		}
+		if err == nil {
+			if row.Movie.ID == 0 {
+				//the id the movie will get, ids of failed rows are used up too like a postgres sequence
+				nextID++
+				result.ID, result.Status = nextID, ImportCreated
+			} else if stored, ok := m.movies[row.Movie.ID]; ok && stored.DeletedAt == nil {
+				result.ID, result.Status = row.Movie.ID, ImportUpdated
+			} else {
+				err = errors.New("movie not found")
+			}
+		}
+		if err != nil {
+			result.ID = 0
+			result.Status = ImportFailed
+			result.Error = err.Error()
+			failed++
+		}
+
+		results = append(results, result)
+	}
+
+	if dryRun || failed > 0 {
+		return results, false, nil
+	}
+
+	for i, row := range rows {
+		id := row.Movie.ID
+		if id == 0 {
+			id = m.insertMovie(row.Movie).ID
+		} else {
+			m.updateMovie(row.Movie)
+		}
+		if row.Genres != nil {
+			m.movieGenres[id] = dedupe(rowGenres[i])
+		}
+	}
+	return results, true, nil
+}
+
+func dedupe(ids []int) []int {
+	seen := make(map[int]bool)
+	out := []int{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func (m *MemoryModel) GenreAll(ctx context.Context) ([]*Genre, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var genres []*Genre
+	for _, stored := range m.genres {
+		g := *stored
+		genres = append(genres, &g)
+	}
+	sort.Slice(genres, func(i, j int) bool { return genres[i].GenreName < genres[j].GenreName })
+	return genres, nil
+}
+
+func (m *MemoryModel) GenresForMovies(ctx context.Context, movieIDs []int) (map[int][]*Genre, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	genres := make(map[int][]*Genre)
+	for _, movieID := range movieIDs {
+		for _, id := range m.movieGenres[movieID] {
+			g := *m.genres[id]
+			genres[movieID] = append(genres[movieID], &g)
+		}
+		sort.Slice(genres[movieID], func(i, j int) bool {
+			return genres[movieID][i].GenreName < genres[movieID][j].GenreName
+		})
+	}
+	return genres, nil
+}
+
+func (m *MemoryModel) GetUser(ctx context.Context, id int) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	u := *stored
+	return &u, nil
+}
+
+func (m *MemoryModel) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.users {
+		if strings.EqualFold(stored.Email, email) {
+			u := *stored
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryModel) SaveUser(ctx context.Context, user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.users {
+		if strings.EqualFold(stored.Email, user.Email) {
+			stored.Password = user.Password
+			stored.Admin = user.Admin
+			user.ID = stored.ID
+			return nil
+		}
+	}
+
+	saved := *user
+	saved.ID = m.nextID()
+	m.users[saved.ID] = &saved
+	user.ID = saved.ID
+	return nil
+}
+
+func (m *MemoryModel) SaveReview(ctx context.Context, review Review) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	//one review per user and movie, a second one is an edit
+	for _, stored := range m.reviews {
+		if stored.MovieID == review.MovieID && stored.UserID == review.UserID {
+			stored.Rating = review.Rating
+			stored.Body = review.Body
+			stored.Updated_At = review.Updated_At
+			m.touch(review.MovieID)
+			return nil
+		}
+	}
+
+	review.ID = m.nextID()
+	review.Hidden = false
+	m.reviews[review.ID] = &review
+	m.touch(review.MovieID)
+	return nil
+}
+
+func (m *MemoryModel) MovieReviews(ctx context.Context, movieID, page, pageSize int) ([]*Review, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var visible []*Review
+	for _, stored := range m.reviews {
+		if stored.MovieID == movieID && !stored.Hidden {
+			r := *stored
+			visible = append(visible, &r)
+		}
+	}
+	sort.Slice(visible, func(i, j int) bool {
+		if !visible[i].Created_At.Equal(visible[j].Created_At) {
+			return visible[i].Created_At.After(visible[j].Created_At)
+		}
+		return visible[i].ID > visible[j].ID
+	})
+
+	reviews := []*Review{}
+	for i := (page - 1) * pageSize; i >= 0 && i < len(visible) && i < page*pageSize; i++ {
+		reviews = append(reviews, visible[i])
+	}
+	return reviews, len(visible), nil
+}
+
+func (m *MemoryModel) HideReview(ctx context.Context, id int, hidden bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.reviews[id]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Hidden = hidden
+	m.touch(stored.MovieID)
+	return nil
+}
+
+func (m *MemoryModel) DeleteReview(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.reviews[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.reviews, id)
+	m.touch(stored.MovieID)
+	return nil
+}
+
+func (m *MemoryModel) UserLists(ctx context.Context, userID int) ([]*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var lists []*List
+	hasDefault := false
+	for _, stored := range m.lists {
+		if stored.UserID == userID {
+			hasDefault = hasDefault || stored.Default
+		}
+	}
+	if !hasDefault {
+		slug, err := newSlug(FavouritesListName)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		id := m.nextID()
+		m.lists[id] = &List{ID: id, UserID: userID, Name: FavouritesListName, Slug: slug, Default: true, Created_At: now, Updated_At: now}
+	}
+
+	for _, stored := range m.lists {
+		if stored.UserID == userID {
+			l := *stored
+			l.Movies = nil
+			lists = append(lists, &l)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].Default != lists[j].Default {
+			return lists[i].Default
+		}
+		if !lists[i].Created_At.Equal(lists[j].Created_At) {
+			return lists[i].Created_At.Before(lists[j].Created_At)
+		}
+		return lists[i].ID < lists[j].ID
+	})
+	return lists, nil
+}
+
+//list returns a copy of a stored list with its movies in order, leaving out movies in the trash
+func (m *MemoryModel) list(stored *List) *List {
+	l := *stored
+	l.Movies = []*Movie{}
+	for _, movieID := range m.listMovies[l.ID] {
+		if movie, ok := m.movies[movieID]; ok && movie.DeletedAt == nil {
+			l.Movies = append(l.Movies, m.movie(movie, false))
+		}
+	}
+	return &l
+}
+
+func (m *MemoryModel) GetList(ctx context.Context, id int) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.lists[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return m.list(stored), nil
+}
+
+func (m *MemoryModel) ListBySlug(ctx context.Context, slug string) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.lists {
+		if stored.Slug == slug {
+			return m.list(stored), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryModel) InsertList(ctx context.Context, list List) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	slug, err := newSlug(list.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	list.ID = m.nextID()
+	list.Slug = slug
+	list.Default = false
+	list.Movies = nil
+	m.lists[list.ID] = &list
+	return list.ID, nil
+}
+
+func (m *MemoryModel) UpdateList(ctx context.Context, list List) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.lists[list.ID]; ok {
+		stored.Name = list.Name
+		stored.Public = list.Public
+		stored.Updated_At = list.Updated_At
+	}
+	return nil
+}
+
+func (m *MemoryModel) DeleteList(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.lists, id)
+	delete(m.listMovies, id)
+	return nil
+}
+
+func (m *MemoryModel) AddListMovie(ctx context.Context, listID, movieID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range m.listMovies[listID] {
+		if id == movieID {
+			return nil
+		}
+	}
+	m.listMovies[listID] = append(m.listMovies[listID], movieID)
+	return nil
+}
+
+func (m *MemoryModel) RemoveListMovie(ctx context.Context, listID, movieID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := m.listMovies[listID]
+	for i, id := range ids {
+		if id == movieID {
+			m.listMovies[listID] = append(ids[:i:i], ids[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *MemoryModel) ReorderList(ctx context.Context, listID int, movieIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	//movies in the trash aren't shown in the list, so they don't have to be in movieIDs.They go at the end
+	current := make(map[int]bool)
+	var trashed []int
+	for _, id := range m.listMovies[listID] {
+		if movie, ok := m.movies[id]; ok && movie.DeletedAt != nil {
+			trashed = append(trashed, id)
+			continue
+		}
+		current[id] = true
+	}
+	if len(current) != len(movieIDs) {
+		return ErrListMovies
+	}
+
+	seen := make(map[int]bool)
+	for _, id := range movieIDs {
+		if seen[id] || !current[id] {
+			return ErrListMovies
+		}
+		seen[id] = true
+	}
+
+	m.listMovies[listID] = append(append([]int(nil), movieIDs...), trashed...)
+	return nil
+}
+
+//movieCredits returns copies of the cast and the crew of a movie, each in billing order
+func (m *MemoryModel) movieCredits(movieID int) ([]*Credit, []*Credit) {
+	cast := []*Credit{}
+	crew := []*Credit{}
+	for _, stored := range m.credits[movieID] {
+		c := *stored
+		c.Name = m.people[c.PersonID].Name
+		if c.Role == RoleActor {
+			cast = append(cast, &c)
+		} else {
+			crew = append(crew, &c)
+		}
+	}
+
+	byBilling := func(credits []*Credit) func(i, j int) bool {
+		return func(i, j int) bool {
+			if credits[i].BillingOrder != credits[j].BillingOrder {
+				return credits[i].BillingOrder < credits[j].BillingOrder
+			}
+			return credits[i].ID < credits[j].ID
+		}
+	}
+	sort.Slice(cast, byBilling(cast))
+	sort.Slice(crew, byBilling(crew))
+	return cast, crew
+}
+
+func (m *MemoryModel) GetPerson(ctx context.Context, id int) (*Person, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.people[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	p := *stored
+	p.Filmography = []*Credit{}
+	for movieID, credits := range m.credits {
+		movie, ok := m.movies[movieID]
+		if !ok || movie.DeletedAt != nil {
+			continue
+		}
+		for _, c := range credits {
+			if c.PersonID == id {
+				credit := *c
+				credit.Name = p.Name
+				credit.MovieTitle = movie.Title
+				p.Filmography = append(p.Filmography, &credit)
+			}
+		}
+	}
+	sort.Slice(p.Filmography, func(i, j int) bool {
+		a, b := m.movies[p.Filmography[i].MovieID], m.movies[p.Filmography[j].MovieID]
+		if !a.ReleaseDate.Equal(b.ReleaseDate.Time) {
+			return a.ReleaseDate.After(b.ReleaseDate.Time)
+		}
+		return p.Filmography[i].ID < p.Filmography[j].ID
+	})
+	return &p, nil
+}
+
+func (m *MemoryModel) SetMovieCredits(ctx context.Context, movieID int, credits []*Credit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := []*Credit{}
+	for _, c := range credits {
+		personID := c.PersonID
+		if personID == 0 {
+			//the person with the lowest id wins, like "order by id limit 1"
+			for id, p := range m.people {
+				if p.Name == c.Name && (personID == 0 || id < personID) {
+					personID = id
+				}
+			}
+		}
+		if personID == 0 {
+			now := time.Now()
+			personID = m.nextID()
+			m.people[personID] = &Person{ID: personID, Name: c.Name, Created_At: now, Updated_At: now}
+		}
+		if _, ok := m.people[personID]; !ok {
+			return fmt.Errorf("person %d doesn't exist", personID)
+		}
+
+		saved = append(saved, &Credit{
+			ID:           m.nextID(),
+			MovieID:      movieID,
+			PersonID:     personID,
+			Role:         c.Role,
+			Character:    c.Character,
+			BillingOrder: c.BillingOrder,
+		})
+	}
+
+	m.credits[movieID] = saved
+	m.touch(movieID)
+	return nil
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//migration is one NNNNNN_name.up.sql file
+type migration struct {
+	version int
+	name    string
+}
+
+//Migrate runs the up migrations in files that are newer than the database and returns how many ran.
+//The version is kept in schema_migrations the same way golang-migrate keeps it so both can be used on one database
+func Migrate(ctx context.Context, db *sql.DB, dialect Dialect, files fs.FS) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `create table if not exists schema_migrations (version bigint not null primary key, dirty boolean not null)`)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int
+	var dirty bool
+	err = db.QueryRowContext(ctx, `select version, dirty from schema_migrations`).Scan(&current, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("migration %d failed half way, fix the database by hand and clear the dirty flag", current)
+	}
+
+	migrations, err := upMigrations(files)
+	if err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	for _, mg := range migrations {
+		if mg.version <= current {
+			continue
+		}
+
+		body, err := fs.ReadFile(files, mg.name)
+		if err != nil {
+			return ran, err
+		}
+
+		err = runMigration(ctx, db, dialect, mg.version, string(body))
+		if err != nil {
+			return ran, fmt.Errorf("%s: %w", mg.name, err)
+		}
+		ran++
+	}
+
+	return ran, nil
+}
+
+//runMigration runs one migration and moves the version in the same transaction, so a failed one leaves nothing behind
+func runMigration(ctx context.Context, db *sql.DB, dialect Dialect, version int, body string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range dialect.statements(body) {
+		_, err = tx.ExecContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from schema_migrations`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `insert into schema_migrations (version, dirty) values ($1, false)`, version)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//upMigrations lists the up migrations in files ordered by version
+func upMigrations(files fs.FS) ([]migration, error) {
+	names, err := fs.Glob(files, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, name := range names {
+		prefix := strings.SplitN(name, "_", 2)[0]
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%s doesn't start with a version number", name)
+		}
+		migrations = append(migrations, migration{version: version, name: name})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
@@ -1,20 +1,50 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
 	"time"
 )
 
-//Models is the wrapper for database
+//ErrNotFound is returned when the row we are looking for doesn't exist
+var ErrNotFound = errors.New("record not found")
+
+//Models is what the handlers use to get to the data.Each field is an interface so tests can use NewMemoryModels instead of postgres
 type Models struct {
-	DB DBModel
+	//WithTx runs work on several repositories in one transaction
+	Transactor
+	Movies  MovieRepository
+	Genres  GenreRepository
+	Users   UserRepository
+	Reviews ReviewRepository
+	Lists   ListRepository
+	People  PersonRepository
+}
+
+//Config is how NewModels sets up the DBModel
+type Config struct {
+	//has to match the driver db was opened with
+	Dialect Dialect
+	//how long a single query may run, 0 means DefaultQueryTimeout
+	QueryTimeout time.Duration
+	//told about every query, like SlowQueryLog and QueryMetrics
+	Hook QueryHook
 }
 
-//NewModels returns models with db pool
-func NewModels(db *sql.DB) Models {
-	return Models{
-		DB: DBModel{DB: db},
+//NewModels returns models with db pool.It prepares every registered query so the schema has to be migrated first
+func NewModels(ctx context.Context, db *sql.DB, cfg Config) (Models, error) {
+	stmts, err := prepare(ctx, db)
+	if err != nil {
+		return Models{}, err
 	}
+
+	m := &DBModel{DB: db, Dialect: cfg.Dialect, QueryTimeout: cfg.QueryTimeout, Hook: cfg.Hook, stmts: stmts}
+	return m.models(), nil
 }
 
 //type for movie
@@ -23,13 +53,29 @@ type Movie struct {
 	Title       string       `json:"title"`
 	Description string       `json:"description"`
 	Year        int          `json:"year"`
-	ReleaseDate time.Time    `json:"release_date"`
+	ReleaseDate Date         `json:"release_date"`
 	Runtime     int          `json:"runtime"`
 	Rating      int          `json:"rating"`
 	MPAARating  string       `json:"mpaa_rating"`
 	Created_At  time.Time    `json:"-"`
 	Updated_At  time.Time    `json:"-"`
+	//starts at 1 and goes up by one with every update
+	Version     int          `json:"version"`
+	//only set when the movie is in the trash
+	DeletedAt   *time.Time   `json:"deleted_at,omitempty"`
 	MovieGenre  map[int]string `json:"genres"`
+	//user ratings from the reviews table, hidden reviews don't count
+	AverageRating float64      `json:"average_rating"`
+	RatingCount   int          `json:"rating_count"`
+	//actors go in Cast, directors and writers in Crew
+	Cast []*Credit `json:"cast"`
+	Crew []*Credit `json:"crew"`
+	//storage keys of the uploaded images, the handlers turn them into Poster and Backdrop urls
+	PosterKey   string `json:"-"`
+	BackdropKey string `json:"-"`
+	//image urls keyed by size ("original", "w185" and so on)
+	Poster   map[string]string `json:"poster,omitempty"`
+	Backdrop map[string]string `json:"backdrop,omitempty"`
 }
 
 //type for genre
@@ -52,9 +98,206 @@ type MovieGenre struct {
 }
 
 
+//MovieRevision is a copy of a movie as it was after one of its updates
+type MovieRevision struct {
+	ID          int       `json:"-"`
+	MovieID     int       `json:"movie_id"`
+	Revision    int       `json:"revision"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Year        int       `json:"year"`
+	ReleaseDate Date      `json:"release_date"`
+	Runtime     int       `json:"runtime"`
+	Rating      int       `json:"rating"`
+	MPAARating  string    `json:"mpaa_rating"`
+	Created_At  time.Time `json:"created_at"`
+	//what changed compared to the revision before this one
+	Changes []FieldChange `json:"changes"`
+}
+
+//FieldChange is one field that differs between two revisions
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+//Diff returns the fields that changed going from prev to r. Fields are named by their json key
+func (r *MovieRevision) Diff(prev *MovieRevision) []FieldChange {
+	changes := []FieldChange{}
+
+	cur := reflect.ValueOf(*r)
+	old := reflect.ValueOf(*prev)
+	t := cur.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		//only the movie data counts, not the bookkeeping fields
+		switch t.Field(i).Name {
+		case "ID", "MovieID", "Revision", "Created_At", "Changes":
+			continue
+		}
+
+		from := old.Field(i).Interface()
+		to := cur.Field(i).Interface()
+		if reflect.DeepEqual(from, to) {
+			continue
+		}
+
+		changes = append(changes, FieldChange{
+			Field: t.Field(i).Tag.Get("json"),
+			From:  from,
+			To:    to,
+		})
+	}
+
+	return changes
+}
+
+//Apply copies the movie data of the revision onto m
+func (r *MovieRevision) Apply(m *Movie) {
+	m.Title = r.Title
+	m.Description = r.Description
+	m.Year = r.Year
+	m.ReleaseDate = r.ReleaseDate
+	m.Runtime = r.Runtime
+	m.Rating = r.Rating
+	m.MPAARating = r.MPAARating
+}
+
+//Review is a user's star rating and text review of a movie. A user has at most one review per movie
+type Review struct {
+	ID         int       `json:"id"`
+	MovieID    int       `json:"movie_id"`
+	UserID     int       `json:"user_id"`
+	Rating     int       `json:"rating"`
+	Body       string    `json:"body"`
+	Hidden     bool      `json:"hidden"`
+	Created_At time.Time `json:"created_at"`
+	Updated_At time.Time `json:"updated_at"`
+}
+
+//List is a user's own list of movies, like a watchlist.Public lists can be shared with their slug
+type List struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"-"`
+	Name       string    `json:"name"`
+	Slug       string    `json:"slug"`
+	Public     bool      `json:"public"`
+	Default    bool      `json:"default"`
+	Created_At time.Time `json:"created_at"`
+	Updated_At time.Time `json:"updated_at"`
+	//the movies in the order the user put them in.Only filled when getting a single list
+	Movies []*Movie `json:"movies,omitempty"`
+}
+
+//FavouritesListName is the name of the default list every user has
+const FavouritesListName = "Favourites"
+
+//roles a person can have on a movie
+const (
+	RoleActor    = "actor"
+	RoleDirector = "director"
+	RoleWriter   = "writer"
+)
+
+//Person is someone who worked on movies
+type Person struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	BirthDate  *time.Time `json:"birth_date,omitempty"`
+	Created_At time.Time  `json:"-"`
+	Updated_At time.Time  `json:"-"`
+	//every credit the person has, only filled by GetPerson
+	Filmography []*Credit `json:"filmography,omitempty"`
+}
+
+//Credit is what one person did on one movie
+type Credit struct {
+	ID         int    `json:"-"`
+	MovieID    int    `json:"movie_id"`
+	MovieTitle string `json:"movie_title,omitempty"`
+	PersonID   int    `json:"person_id"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	//only for actors
+	Character    string `json:"character,omitempty"`
+	BillingOrder int    `json:"billing_order"`
+}
+
 //User is the type for users
 type User struct{
 	ID int
 	Email string
 	Password string
-}
\ No newline at end of file
+	//Admin users can moderate reviews
+	Admin bool
+}
+
+//DateLayout is how dates without a time are written
+const DateLayout = "2006-01-02"
+
+//Date is a day without a time of day.In json it is written as "2006-01-02" and read from that or from RFC3339,
+//in which case the time part is dropped.The zero Date is null.
+//It goes in and out of the database like a time.Time
+type Date struct {
+	time.Time
+}
+
+//NewDate drops the time of day from t
+func NewDate(t time.Time) Date {
+	return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.Format(DateLayout))
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*d = Date{}
+		return nil
+	}
+
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("date must be a string like %q", DateLayout)
+	}
+
+	//old clients send an empty string when there is no date
+	if s == "" {
+		*d = Date{}
+		return nil
+	}
+
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return fmt.Errorf("%q is not a date, use YYYY-MM-DD or RFC3339", s)
+		}
+	}
+
+	*d = NewDate(t)
+	return nil
+}
+
+//Scan reads the date columns, the drivers give us a time.Time
+func (d *Date) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = Date{}
+	case time.Time:
+		*d = NewDate(v)
+	default:
+		return fmt.Errorf("can't scan %T into a date", value)
+	}
+	return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.Time, nil
+}
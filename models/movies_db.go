@@ -3,30 +3,59 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
-
+//DBModel runs the models on a sql database
 type DBModel struct {
 	DB *sql.DB
+	//which sql flavour DB speaks
+	Dialect Dialect
+	//how long one query may take.Bulk work like imports and exports has its own longer limit
+	QueryTimeout time.Duration
+	//told about every query, nil for none
+	Hook QueryHook
+	//set on the DBModel WithTx gives its func, every query then runs in the transaction
+	tx *sql.Tx
+	//the prepared registry, shared with the DBModels of transactions
+	stmts *statements
+}
+
+//DefaultQueryTimeout is used when a DBModel has no QueryTimeout
+const DefaultQueryTimeout = 3 * time.Second
+
+//withTimeout limits ctx to one query's worth of time.ctx is usually the request's so a client that goes away
+//cancels the query too
+func (m *DBModel) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := m.QueryTimeout
+	if timeout <= 0 {
+		timeout = DefaultQueryTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
+//ratingColumns adds the average user rating and the number of ratings to a select on movies
+const ratingColumns = `(select coalesce(avg(rv.rating), 0) from reviews rv where rv.movie_id = movies.id and not rv.hidden),
+	(select count(*) from reviews rv where rv.movie_id = movies.id and not rv.hidden)`
+
+var getMovieQuery = register("movies.get", `select id, title, description, year, release_date, rating, runtime, mpaa_rating,
+	created_at, updated_at, poster_key, backdrop_key, version, `+ratingColumns+` from movies where id = $1 and deleted_at is null
+`)
+
 //Get returns one movie and err if any from database
-func (m *DBModel) Get(id int) (*Movie, error) {
+func (m *DBModel) Get(ctx context.Context, id int) (*Movie, error) {
 	//context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	//query for database. id=$1 is the placeholder
-	query := `select id, title, description, year, release_date, rating, runtime, mpaa_rating,
-	created_at, updated_at from movies where id = $1
-`
-
-	//using query variable to populate the row variable.
+	//the query is prepared on startup, see getMovieQuery
 	//QueryRowContext executes a query that is expected to return at most one row. QueryRowContext always returns a non-nil value. Errors are deferred until Row's Scan method is called. If the query selects no rows, the *Row's Scan will return ErrNoRows. Otherwise, the *Row's Scan scans the first selected row and discards the rest.
-	row := m.DB.QueryRowContext(ctx, query, id)
+	row := m.db().QueryRowContext(ctx, getMovieQuery, id)
 
 	//imagine this as the Movie struct
 	var movie Movie
@@ -42,76 +71,103 @@ func (m *DBModel) Get(id int) (*Movie, error) {
 		&movie.MPAARating,
 		&movie.Created_At,
 		&movie.Updated_At,
+		&movie.PosterKey,
+		&movie.BackdropKey,
+		&movie.Version,
+		&movie.AverageRating,
+		&movie.RatingCount,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	//get the genres, if any
-
-	//for querying one genre for row variable
-	//mg is just an alias for movies_genre.and g is an alias for genres table
-	query = `
-	select
-		mg.id,mg.movie_id,mg.genre_id,g.genre_name
-	from
-		movies_genres mg
-		left join genres g on (g.id = mg.genre_id)
-	where
-		mg.movie_id = $1
-	`
-	//gives me a specific row depending on my id provided.
-	rows, _ := m.DB.QueryContext(ctx, query, id)
-	//closing the context to avoid any resource leaks.
-	defer rows.Close()
-
-	genres := make(map[int]string)
-
-	//Next() function is used to get the next element in list go golang.
-	for rows.Next() {
-		var mg MovieGenre
-		//scans from rows
-		err := rows.Scan(
-			&mg.ID,
-			&mg.MovieID,
-			&mg.GenreID,
-			&mg.Genre.GenreName,
-		)
-		if err != nil {
-			return nil, err
-		}
-		//setting our map values
-		genres[mg.ID] = mg.Genre.GenreName
+	//get the genres, if any.Keyed by genre id like in All
+	genres, err := m.GenresForMovies(ctx, []int{id})
+	if err != nil {
+		return nil, err
 	}
+	movie.MovieGenre = genreMap(genres[id])
 
-	movie.MovieGenre = genres
+	//and the cast and crew
+	movie.Cast, movie.Crew, err = m.movieCredits(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 
 	//we are returning a movie reference cause we are returning pointer.
 	return &movie, nil
 }
 
+//MovieFilter is how movie listings can be narrowed down.The zero value lists every movie
+type MovieFilter struct {
+	GenreID int
+	//matches any part of the title, ignoring case
+	Title string
+	//comma separated fields to sort by, a minus in front sorts descending, like "-year,title".
+	//Empty sorts by title.See movieSorts for the fields
+	Sort string
+}
+
+//movieColumns is what we select for a movie in the listings
+const movieColumns = `id, title, description, year, release_date, rating, runtime, mpaa_rating,
+	created_at, updated_at, poster_key, backdrop_key, version, ` + ratingColumns
+
+//where adds the filter's conditions to a select on movies.Movies in the trash are never listed
+func (f MovieFilter) where(b *selectBuilder) {
+	b.where("deleted_at is null")
+
+	if f.GenreID > 0 {
+		b.where("id in (select movie_id from movies_genres where genre_id = ?)", f.GenreID)
+	}
+	if f.Title != "" {
+		//% and _ in the title are meant literally
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Title)
+		b.where(`lower(title) like lower(?) escape '\'`, "%"+escaped+"%")
+	}
+}
+
+//apply adds the filter's conditions and its sort to a select on movies
+func (f MovieFilter) apply(b *selectBuilder) error {
+	f.where(b)
+
+	sort := f.Sort
+	if sort == "" {
+		sort = "title"
+	}
+	err := b.sortBy(sort, movieSorts)
+	if err != nil {
+		return err
+	}
+	//movies that sort the same keep one order so pages don't overlap
+	b.orderBy("id")
+	return nil
+}
+
 //All() returns all movies and if serched by genre it will show all movies with same genre from database
-func (m *DBModel) All(genre ...int) ([]*Movie, error) {
+func (m *DBModel) All(ctx context.Context, genre ...int) ([]*Movie, error) {
 	//setup our context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	//sort by genre functionality starts from here
-	where := ""
+	var filter MovieFilter
 	//if there is an argument passed calling this All function this snippet will run and give us a query for getting all movies with same genre.
 	//genre[0] will be whichever id we supplied while calling this function
 	if len(genre) > 0 {
-		where = fmt.Sprintf("where id in (select movie_id from movies_genres where genre_id = %d)", genre[0])
+		filter.GenreID = genre[0]
 	}
-
-	//query for getting all movies ordered by title.And if we search by same genre it will put the "where" variable data with query in this "query" variable.
-	query := fmt.Sprintf(`select id, title, description, year, release_date, rating, runtime, mpaa_rating,
-	created_at, updated_at from movies %s order by title`, where)
+	//query for getting all movies ordered by title.And if we search by same genre the builder adds it to the where clause
+	b := selectFrom("movies", movieColumns)
+	err := filter.apply(b)
+	if err != nil {
+		return nil, err
+	}
+	query, args := b.build()
 
 	//sort by genre functionality ends here
 
 	//store that query result in the rows variable
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.db().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -136,73 +192,162 @@ func (m *DBModel) All(genre ...int) ([]*Movie, error) {
 			&movie.MPAARating,
 			&movie.Created_At,
 			&movie.Updated_At,
+			&movie.PosterKey,
+			&movie.BackdropKey,
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
 		)
 		if err != nil {
 			return nil, err
 		}
 
-		//get the genres, if any
-
-		//for querying one genre for row variable
-		//mg is just an alias for movies_genre.and g is an alias for genres table
-		genreQuery := `
-	select
-		mg.id,mg.movie_id,mg.genre_id,g.genre_name
-	from
-		movies_genres mg
-		left join genres g on (g.id = mg.genre_id)
-	where
-		mg.movie_id = $1
-	`
-		//gives me a specific row depending on my id provided.
-		GenreRows, _ := m.DB.QueryContext(ctx, genreQuery, movie.ID)
-		//closing the context to avoid any resource leaks.
-		defer rows.Close()
-
-		//creating a map for genres
-		genres := make(map[int]string)
-
-		//Next() function is used to get the next element in list go golang.
-		for GenreRows.Next() {
-			var mg MovieGenre
-			//scanning the GenreRows data into MovieGenre variable
-			err := GenreRows.Scan(
-				&mg.ID,
-				&mg.MovieID,
-				&mg.GenreID,
-				&mg.Genre.GenreName,
-			)
-			if err != nil {
-				return nil, err
-			}
-			//setting our map values
-			genres[mg.ID] = mg.Genre.GenreName
-		}
-		//closing GenreRows when we are done looping through the GenreRows.
-		GenreRows.Close()
-
-		//assign genres to the MovieGenre field of the movie variable
-		movie.MovieGenre = genres
 		//append movie reference to the movies variable to our slice of movies
 		movies = append(movies, &movie)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	//the cursor has to be closed before the next queries, sqlite has only one connection and a transaction too
+	rows.Close()
+
+	//the genres and the cast and crew of all movies come from one query each
+	ids := make([]int, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	genres, err := m.GenresForMovies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	cast, crew, err := m.creditsForMovies(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, movie := range movies {
+		movie.MovieGenre = genreMap(genres[movie.ID])
+		movie.Cast, movie.Crew = cast[movie.ID], crew[movie.ID]
+	}
 
 	//and finally return all data
 	return movies, nil
 }
 
+//ListMovies returns one page of the movies matching the filter ordered by title, and how many match in total.
+//Unlike All it doesn't get genres and credits, so callers can get those for the whole page at once
+func (m *DBModel) ListMovies(ctx context.Context, filter MovieFilter, limit, offset int) ([]*Movie, int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	b := selectFrom("movies", movieColumns)
+	err := filter.apply(b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	count, args := b.count()
+	err = m.db().QueryRowContext(ctx, count, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query, args := b.page(limit, offset).build()
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.Description,
+			&movie.Year,
+			&movie.ReleaseDate,
+			&movie.Rating,
+			&movie.Runtime,
+			&movie.MPAARating,
+			&movie.Created_At,
+			&movie.Updated_At,
+			&movie.PosterKey,
+			&movie.BackdropKey,
+			&movie.Version,
+			&movie.AverageRating,
+			&movie.RatingCount,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	return movies, total, rows.Err()
+}
+
+//GenresForMovies gets the genres of many movies in one query, keyed by movie id
+func (m *DBModel) GenresForMovies(ctx context.Context, movieIDs []int) (map[int][]*Genre, error) {
+	genres := make(map[int][]*Genre)
+	if len(movieIDs) == 0 {
+		return genres, nil
+	}
+
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	args := make([]interface{}, len(movieIDs))
+	for i, id := range movieIDs {
+		args[i] = id
+	}
+
+	query, args := selectFrom("movies_genres mg join genres g on (g.id = mg.genre_id)", "mg.movie_id, g.id, g.genre_name, g.created_at, g.updated_at").
+		where("mg.movie_id in ("+strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")+")", args...).
+		orderBy("g.genre_name").
+		build()
+
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movieID int
+		var g Genre
+		err := rows.Scan(&movieID, &g.ID, &g.GenreName, &g.Created_At, &g.Updated_At)
+		if err != nil {
+			return nil, err
+		}
+		genres[movieID] = append(genres[movieID], &g)
+	}
+
+	return genres, rows.Err()
+}
+
+//genreMap turns the genres of a movie into Movie.MovieGenre, keyed by genre id
+func genreMap(genres []*Genre) map[int]string {
+	m := make(map[int]string, len(genres))
+	for _, g := range genres {
+		m[g.ID] = g.GenreName
+	}
+	return m
+}
+
+var allGenresQuery = register("genres.all", `select id, genre_name, created_at, updated_at from genres order by genre_name
+`)
+
 //for getting all genres from database
-func (m *DBModel) GenreAll() ([]*Genre, error) {
+func (m *DBModel) GenreAll(ctx context.Context) ([]*Genre, error) {
 	//setup our context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	//query for getting all genres database.
-	query := `select id, genre_name, created_at, updated_at from genres order by genre_name
-`
-
-	//using query variable to populate the row variable.
-	rows, err := m.DB.QueryContext(ctx, query)
+	//the query is prepared on startup, see allGenresQuery
+	rows, err := m.db().QueryContext(ctx, allGenresQuery)
 	if err != nil {
 		return nil, err
 	}
@@ -227,18 +372,35 @@ func (m *DBModel) GenreAll() ([]*Genre, error) {
 	return genres, nil
 }
 
-//inserts new movie in the database
-func (m *DBModel) InsertMovie(movie Movie) error {
+//querier is what *sql.DB and *sql.Tx have in common, so the same queries can run inside a transaction or outside of one
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+//inserts new movie in the database and fills in the id, timestamps and version it was saved with
+func (m *DBModel) InsertMovie(ctx context.Context, movie *Movie) error {
 	//setup our context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
+	err := insertMovie(ctx, m.db(), movie)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+var insertMovieQuery = register("movies.insert", `insert into movies (title, description, year, release_date, runtime, rating, mpaa_rating,
+			  created_at,updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id, created_at, updated_at, version`)
+
+func insertMovie(ctx context.Context, q querier, movie *Movie) error {
 	//query for adding new movies in database.
-	query := `insert into movies (title, description, year, release_date, runtime, rating, mpaa_rating,
-			  created_at,updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	
-	//adding data from editMovie to database
-	_, err := m.DB.ExecContext(ctx, query,
+	//adding data from editMovie to database.returning gives us the id postgres picked for the new movie and the rest of what it saved
+	return q.QueryRowContext(ctx, insertMovieQuery,
 		movie.Title,
 		movie.Description,
 		movie.Year,
@@ -248,28 +410,49 @@ func (m *DBModel) InsertMovie(movie Movie) error {
 		movie.MPAARating,
 		movie.Created_At,
 		movie.Updated_At,
-	)
+	).Scan(&movie.ID, &movie.Created_At, &movie.Updated_At, &movie.Version)
+}
+
+//for updating movies in database. Every update is also saved as a new revision in movie_revisions.
+//movie gets what was saved, with its new version.A movie that doesn't exist or is in the trash gives ErrNotFound
+func (m *DBModel) UpdateMovie(ctx context.Context, movie *Movie) error {
+	//setup our context
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
 
+	//the update and its revision have to be saved together
+	err := m.transaction(ctx, func(tx *DBModel) error {
+		return updateMovie(ctx, tx.db(), movie)
+	})
 	if err != nil {
 		log.Println(err)
-		return err
 	}
-
-	return nil
+	return err
 }
 
-//for updating movies in database
-func (m *DBModel) UpdateMovie(movie Movie) error {
-	//setup our context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+var firstRevisionQuery = register("movie_revisions.insert_first", `insert into movie_revisions (movie_id, revision, title, description, year, release_date, runtime, rating, mpaa_rating, created_at)
+			  select id, 1, title, description, year, release_date, runtime, rating, mpaa_rating, updated_at from movies
+			  where id = $1 and not exists (select 1 from movie_revisions where movie_id = $1)`)
+
+var updateMovieQuery = register("movies.update", `update movies set title = $1, description = $2, year = $3, release_date = $4, runtime = $5, rating = $6, mpaa_rating = $7,
+			  updated_at = $8, version = version + 1 where id = $9 and deleted_at is null
+			  returning title, description, year, release_date, runtime, rating, mpaa_rating, created_at, updated_at,
+			  poster_key, backdrop_key, version, deleted_at`)
+
+var insertRevisionQuery = register("movie_revisions.insert", `insert into movie_revisions (movie_id, revision, title, description, year, release_date, runtime, rating, mpaa_rating, created_at)
+			  select $1, coalesce(max(revision), 0) + 1, $2, $3, $4, $5, $6, $7, $8, $9 from movie_revisions where movie_id = $1`)
+
+//updateMovie should run in a transaction, it's three statements that belong together
+func updateMovie(ctx context.Context, q querier, movie *Movie) error {
+	//movies that existed before we kept revisions have no history yet, so we save how they look right now as the first revision
+	_, err := q.ExecContext(ctx, firstRevisionQuery, movie.ID)
+	if err != nil {
+		return err
+	}
 
 	//query for updating data in database.
-	query := `update movies set title = $1, description = $2, year = $3, release_date = $4, runtime = $5, rating = $6, mpaa_rating = $7,
-			  updated_at = $8 where id = $9`
-	
 	//adding data from editMovie to database
-	_, err := m.DB.ExecContext(ctx, query,
+	err = q.QueryRowContext(ctx, updateMovieQuery,
 		movie.Title,
 		movie.Description,
 		movie.Year,
@@ -279,29 +462,233 @@ func (m *DBModel) UpdateMovie(movie Movie) error {
 		movie.MPAARating,
 		movie.Updated_At,
 		movie.ID,
+	).Scan(
+		&movie.Title,
+		&movie.Description,
+		&movie.Year,
+		&movie.ReleaseDate,
+		&movie.Runtime,
+		&movie.Rating,
+		&movie.MPAARating,
+		&movie.Created_At,
+		&movie.Updated_At,
+		&movie.PosterKey,
+		&movie.BackdropKey,
+		&movie.Version,
+		&movie.DeletedAt,
 	)
-
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
-	return nil
+	//and finally the new version of the movie becomes the next revision
+	_, err = q.ExecContext(ctx, insertRevisionQuery,
+		movie.ID,
+		movie.Title,
+		movie.Description,
+		movie.Year,
+		movie.ReleaseDate,
+		movie.Runtime,
+		movie.Rating,
+		movie.MPAARating,
+		movie.Updated_At,
+	)
+	return err
 }
 
-//for deleting a movie
-func (m *DBModel) DeleteMovieDb(id int) error{
+var trashMovieQuery = register("movies.trash", `update movies set deleted_at = $1, updated_at = $1 where id = $2 and deleted_at is null`)
+
+//for deleting a movie. It only moves the movie to the trash by setting deleted_at, use PurgeMovies to remove it for good
+func (m *DBModel) DeleteMovieDb(ctx context.Context, id int) error{
 	//context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	//query for deleting movie database. id=$1 is the placeholder
-	query := `delete from movies where id = $1`
-
-	//this will execute the delete query and delete a movie with same id
-	_ , err := m.DB.ExecContext(ctx,query,id)
+	//query for soft deleting a movie. id=$2 is the placeholder
+	//this will execute trashMovieQuery and move the movie with same id to the trash
+	result, err := m.db().ExecContext(ctx, trashMovieQuery, time.Now(), id)
 	if err != nil{
 		return err
 	}
+
+	//if nothing changed the movie doesn't exist or is already in the trash
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+var touchMovieQuery = register("movies.touch", `update movies set updated_at = $1 where id = $2`)
+
+//touchMovie moves the updated_at of a movie when something else its responses show changes, like its reviews
+//or credits.Last-Modified comes from updated_at, so it has to move with everything in the response
+func touchMovie(ctx context.Context, q querier, movieID int) error {
+	_, err := q.ExecContext(ctx, touchMovieQuery, time.Now(), movieID)
+	return err
+}
+
+var lastModifiedQuery = register("movies.last_modified", `select updated_at from movies order by updated_at desc limit 1`)
+
+//LastModified is the newest updated_at of all movies, the ones in the trash too.A movie leaving a listing,
+//by going to the trash or out of a genre, only moves its own updated_at so listings can't go by what they show
+func (m *DBModel) LastModified(ctx context.Context) (time.Time, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var modified time.Time
+	err := m.db().QueryRowContext(ctx, lastModifiedQuery).Scan(&modified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return modified, err
+}
+
+var deletedMoviesQuery = register("movies.deleted", `select id, title, description, year, release_date, rating, runtime, mpaa_rating,
+	created_at, updated_at, deleted_at from movies where deleted_at is not null order by deleted_at desc`)
+
+//DeletedMovies returns all movies in the trash, the most recently deleted first
+func (m *DBModel) DeletedMovies(ctx context.Context) ([]*Movie, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, deletedMoviesQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movies []*Movie
+
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.Description,
+			&movie.Year,
+			&movie.ReleaseDate,
+			&movie.Rating,
+			&movie.Runtime,
+			&movie.MPAARating,
+			&movie.Created_At,
+			&movie.Updated_At,
+			&movie.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	return movies, rows.Err()
+}
+
+var restoreMovieQuery = register("movies.restore", `update movies set deleted_at = null, updated_at = $1 where id = $2 and deleted_at is not null`)
+
+//RestoreMovie takes a movie back out of the trash
+func (m *DBModel) RestoreMovie(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, restoreMovieQuery, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+var purgeMovieGenresQuery = register("movies_genres.purge", `delete from movies_genres where movie_id in
+		(select id from movies where deleted_at is not null and deleted_at < $1)`)
+
+var purgeMoviesQuery = register("movies.purge", `delete from movies where deleted_at is not null and deleted_at < $1`)
+
+//PurgeMovies hard deletes every movie that was moved to the trash before the given time and returns how many were removed
+func (m *DBModel) PurgeMovies(ctx context.Context, before time.Time) (int64, error) {
+	//purging can take a while on a big trash so we give it more time than the other queries
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	//genres have to go together with the movies so we do both in one transaction
+	var n int64
+	err := m.transaction(ctx, func(tx *DBModel) error {
+		_, err := tx.db().ExecContext(ctx, purgeMovieGenresQuery, before)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.db().ExecContext(ctx, purgeMoviesQuery, before)
+		if err != nil {
+			return err
+		}
+
+		n, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+//imageQueries are the queries SetMovieImage runs for each kind of image, reading the old key and saving the new one
+var imageQueries = map[string][2]string{
+	"poster": {
+		register("movies.poster_key", `select poster_key from movies where id = $1 and deleted_at is null`),
+		register("movies.set_poster_key", `update movies set poster_key = $1, updated_at = $2 where id = $3 and deleted_at is null`),
+	},
+	"backdrop": {
+		register("movies.backdrop_key", `select backdrop_key from movies where id = $1 and deleted_at is null`),
+		register("movies.set_backdrop_key", `update movies set backdrop_key = $1, updated_at = $2 where id = $3 and deleted_at is null`),
+	},
+}
+
+//SetMovieImage saves the storage key of a movie's poster or backdrop and returns the key it replaced
+func (m *DBModel) SetMovieImage(ctx context.Context, movieID int, kind, key string) (string, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	queries, ok := imageQueries[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown image kind %q", kind)
+	}
+
+	var old string
+	err := m.db().QueryRowContext(ctx, queries[0], movieID).Scan(&old)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	//the movie can go to the trash between the two queries
+	result, err := m.db().ExecContext(ctx, queries[1], key, time.Now(), movieID)
+	if err != nil {
+		return "", err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", ErrNotFound
+	}
+
+	return old, nil
+}
@@ -0,0 +1,304 @@
+package models_test
+
+import (
+	"backend/migrations"
+	"backend/models"
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListMoviesFilterAndSort(t *testing.T) {
+	ctx := context.Background()
+
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, title := range []string{"Alien", "Brazil", "Casablanca"} {
+				date := time.Date(1942+i*20, 1, 1, 0, 0, 0, 0, time.UTC)
+				movie := &models.Movie{Title: title, Year: date.Year(), Rating: 5 - i, ReleaseDate: models.NewDate(date), Created_At: date, Updated_At: date}
+				err := m.Movies.InsertMovie(ctx, movie)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			list := func(filter models.MovieFilter) []string {
+				t.Helper()
+				movies, _, err := m.Movies.ListMovies(ctx, filter, 10, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var titles []string
+				for _, movie := range movies {
+					titles = append(titles, movie.Title)
+				}
+				return titles
+			}
+
+			if got := list(models.MovieFilter{Sort: "-year"}); !reflect.DeepEqual(got, []string{"Casablanca", "Brazil", "Alien"}) {
+				t.Errorf("unexpected order %q", got)
+			}
+			if got := list(models.MovieFilter{Sort: "rating,-title"}); !reflect.DeepEqual(got, []string{"Casablanca", "Brazil", "Alien"}) {
+				t.Errorf("unexpected order %q", got)
+			}
+
+			//a title full of sql only matches itself
+			if got := list(models.MovieFilter{Title: "' or '1'='1"}); len(got) != 0 {
+				t.Errorf("expected no movies, got %q", got)
+			}
+
+			_, _, err := m.Movies.ListMovies(ctx, models.MovieFilter{Sort: "title; delete from movies"}, 10, 0)
+			if !errors.Is(err, models.ErrInvalidSort) {
+				t.Errorf("expected ErrInvalidSort, got %v", err)
+			}
+			if got := list(models.MovieFilter{}); len(got) != 3 {
+				t.Errorf("expected all three movies to be left, got %q", got)
+			}
+		})
+	}
+}
+
+//TestUpdatedAtMoves checks that updated_at, and so Last-Modified, moves with everything a movie response shows
+func TestUpdatedAtMoves(t *testing.T) {
+	ctx := context.Background()
+
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			then := time.Now().Add(-time.Hour)
+			movie := &models.Movie{Title: "Alien", ReleaseDate: models.NewDate(then), Created_At: then, Updated_At: then}
+			err := m.Movies.InsertMovie(ctx, movie)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			last := then
+			moved := func(what string) {
+				t.Helper()
+				got, err := m.Movies.LastModified(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !got.After(last) {
+					t.Errorf("%s didn't move updated_at, still %v", what, got)
+				}
+				last = got
+			}
+
+			err = m.Reviews.SaveReview(ctx, models.Review{MovieID: movie.ID, UserID: 1, Rating: 4, Created_At: then, Updated_At: then})
+			if err != nil {
+				t.Fatal(err)
+			}
+			moved("a review")
+
+			reviews, _, err := m.Reviews.MovieReviews(ctx, movie.ID, 1, 10)
+			if err != nil || len(reviews) != 1 {
+				t.Fatalf("expected the review, got %v, %v", reviews, err)
+			}
+			err = m.Reviews.HideReview(ctx, reviews[0].ID, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			moved("hiding a review")
+
+			err = m.Reviews.DeleteReview(ctx, reviews[0].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			moved("deleting a review")
+
+			err = m.People.SetMovieCredits(ctx, movie.ID, []*models.Credit{{Name: "Ridley Scott", Role: models.RoleDirector}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			moved("the credits")
+
+			//the movie isn't in the listings anymore but they changed
+			err = m.Movies.DeleteMovieDb(ctx, movie.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			moved("the trash")
+		})
+	}
+}
+
+func TestTrashedMoviesCantBeEdited(t *testing.T) {
+	ctx := context.Background()
+
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			movie := &models.Movie{Title: "Alien", ReleaseDate: models.NewDate(now), Created_At: now, Updated_At: now}
+			err := m.Movies.InsertMovie(ctx, movie)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = m.Movies.DeleteMovieDb(ctx, movie.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			movie.Title = "Aliens"
+			err = m.Movies.UpdateMovie(ctx, movie)
+			if !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("UpdateMovie: expected ErrNotFound, got %v", err)
+			}
+			_, err = m.Movies.SetMovieImage(ctx, movie.ID, "poster", "key")
+			if !errors.Is(err, models.ErrNotFound) {
+				t.Errorf("SetMovieImage: expected ErrNotFound, got %v", err)
+			}
+
+			revisions, err := m.Movies.MovieRevisions(ctx, movie.ID)
+			if err != nil || len(revisions) != 0 {
+				t.Errorf("the failed update shouldn't leave revisions, got %v, %v", revisions, err)
+			}
+		})
+	}
+}
+
+func TestSetMovieImageUnknownKind(t *testing.T) {
+	ctx := context.Background()
+
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			movie := &models.Movie{Title: "Alien", ReleaseDate: models.NewDate(now), Created_At: now, Updated_At: now}
+			err := m.Movies.InsertMovie(ctx, movie)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = m.Movies.SetMovieImage(ctx, movie.ID, "poster", "first")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = m.Movies.SetMovieImage(ctx, movie.ID, "banner", "second")
+			if err == nil || err.Error() != `unknown image kind "banner"` {
+				t.Fatalf("expected an unknown kind error, got %v", err)
+			}
+
+			//the poster is still the first one
+			old, err := m.Movies.SetMovieImage(ctx, movie.ID, "poster", "third")
+			if err != nil || old != "first" {
+				t.Errorf("expected the first poster to be replaced, got %q, %v", old, err)
+			}
+		})
+	}
+}
+
+//TestAllLoadsCreditsAtOnce checks that the genres and the cast and crew of the whole catalogue come from one query each
+func TestAllLoadsCreditsAtOnce(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := models.OpenSQLite(filepath.Join(t.TempDir(), "movies.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = models.Migrate(ctx, db, models.SQLite, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := &models.QueryMetrics{}
+	m, err := models.NewModels(ctx, db, models.Config{Dialect: models.SQLite, Hook: metrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, title := range []string{"Alien", "Brazil", "Casablanca"} {
+		insert(ctx, t, m, title)
+	}
+	_, err = db.Exec(`insert into genres (id, genre_name, created_at, updated_at) values (1, 'Horror', current_timestamp, current_timestamp)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	movies, err := m.Movies.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.People.SetMovieCredits(ctx, movies[0].ID, []*models.Credit{
+		{Name: "Sigourney Weaver", Role: models.RoleActor},
+		{Name: "Ridley Scott", Role: models.RoleDirector},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.People.SetMovieCredits(ctx, movies[2].ID, []*models.Credit{{Name: "Ingrid Bergman", Role: models.RoleActor}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`insert into movies_genres (movie_id, genre_id, created_at, updated_at) values ($1, 1, current_timestamp, current_timestamp)`, movies[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := metrics.Snapshot()
+	movies, err = m.Movies.All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := metrics.Snapshot()
+	if got := after["movie_credits.select"].Count - before["movie_credits.select"].Count; got != 1 {
+		t.Errorf("expected one credits query, got %d", got)
+	}
+	if got := after["movies_genres.select"].Count - before["movies_genres.select"].Count; got != 1 {
+		t.Errorf("expected one genres query, got %d", got)
+	}
+
+	if len(movies[0].MovieGenre) != 1 || movies[0].MovieGenre[1] != "Horror" || len(movies[1].MovieGenre) != 0 {
+		t.Errorf("unexpected genres %v %v", movies[0].MovieGenre, movies[1].MovieGenre)
+	}
+
+	if len(movies[0].Cast) != 1 || movies[0].Cast[0].Name != "Sigourney Weaver" || len(movies[0].Crew) != 1 {
+		t.Errorf("unexpected credits of Alien %+v %+v", movies[0].Cast, movies[0].Crew)
+	}
+	if movies[1].Cast == nil || len(movies[1].Cast) != 0 || len(movies[1].Crew) != 0 {
+		t.Errorf("Brazil should have empty credits, got %+v %+v", movies[1].Cast, movies[1].Crew)
+	}
+	if len(movies[2].Cast) != 1 || movies[2].Cast[0].Name != "Ingrid Bergman" {
+		t.Errorf("unexpected credits of Casablanca %+v", movies[2].Cast)
+	}
+}
+
+//TestGenreErrors checks that a failing genre query is returned and not run into
+func TestGenreErrors(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := models.OpenSQLite(filepath.Join(t.TempDir(), "movies.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = models.Migrate(ctx, db, models.SQLite, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := models.NewModels(ctx, db, models.Config{Dialect: models.SQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	movie := &models.Movie{Title: "Alien", ReleaseDate: models.NewDate(now), Created_At: now, Updated_At: now}
+	err = m.Movies.InsertMovie(ctx, movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec("drop table movies_genres")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Movies.Get(ctx, movie.ID)
+	if err == nil {
+		t.Error("Get should fail without movies_genres")
+	}
+	_, err = m.Movies.All(ctx)
+	if err == nil {
+		t.Error("All should fail without movies_genres")
+	}
+}
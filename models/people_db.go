@@ -0,0 +1,192 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var movieCreditsQuery = register("movie_credits.by_movie", `select mc.id, mc.movie_id, mc.person_id, p.name, mc.role, mc.character_name, mc.billing_order
+	from movie_credits mc join people p on (p.id = mc.person_id)
+	where mc.movie_id = $1 order by mc.billing_order, mc.id`)
+
+//movieCredits returns the cast and the crew of a movie, each in billing order
+func (m *DBModel) movieCredits(ctx context.Context, movieID int) ([]*Credit, []*Credit, error) {
+	rows, err := m.db().QueryContext(ctx, movieCreditsQuery, movieID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	cast := []*Credit{}
+	crew := []*Credit{}
+
+	for rows.Next() {
+		var c Credit
+		err := rows.Scan(
+			&c.ID,
+			&c.MovieID,
+			&c.PersonID,
+			&c.Name,
+			&c.Role,
+			&c.Character,
+			&c.BillingOrder,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if c.Role == RoleActor {
+			cast = append(cast, &c)
+		} else {
+			crew = append(crew, &c)
+		}
+	}
+
+	return cast, crew, rows.Err()
+}
+
+//creditsForMovies returns the cast and the crew of every movie in movieIDs by movie id, from one query.
+//Movies without credits get empty lists
+func (m *DBModel) creditsForMovies(ctx context.Context, movieIDs []int) (map[int][]*Credit, map[int][]*Credit, error) {
+	cast := make(map[int][]*Credit)
+	crew := make(map[int][]*Credit)
+	if len(movieIDs) == 0 {
+		return cast, crew, nil
+	}
+
+	args := make([]interface{}, len(movieIDs))
+	for i, id := range movieIDs {
+		args[i] = id
+		cast[id], crew[id] = []*Credit{}, []*Credit{}
+	}
+
+	query, args := selectFrom("movie_credits mc join people p on (p.id = mc.person_id)",
+		"mc.id, mc.movie_id, mc.person_id, p.name, mc.role, mc.character_name, mc.billing_order").
+		where("mc.movie_id in ("+strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")+")", args...).
+		orderBy("mc.movie_id", "mc.billing_order", "mc.id").
+		build()
+
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Credit
+		err := rows.Scan(&c.ID, &c.MovieID, &c.PersonID, &c.Name, &c.Role, &c.Character, &c.BillingOrder)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if c.Role == RoleActor {
+			cast[c.MovieID] = append(cast[c.MovieID], &c)
+		} else {
+			crew[c.MovieID] = append(crew[c.MovieID], &c)
+		}
+	}
+
+	return cast, crew, rows.Err()
+}
+
+var filmographyQuery = register("movie_credits.by_person", `select mc.id, mc.movie_id, mv.title, mc.person_id, mc.role, mc.character_name, mc.billing_order
+	from movie_credits mc join movies mv on (mv.id = mc.movie_id)
+	where mc.person_id = $1 and mv.deleted_at is null order by mv.release_date desc, mc.id`)
+
+var getPersonQuery = register("people.get", `select id, name, birth_date, created_at, updated_at from people where id = $1`)
+
+//GetPerson returns one person with every movie they worked on, newest first.Movies in the trash are left out
+func (m *DBModel) GetPerson(ctx context.Context, id int) (*Person, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var p Person
+	err := m.db().QueryRowContext(ctx, getPersonQuery, id).Scan(
+		&p.ID,
+		&p.Name,
+		&p.BirthDate,
+		&p.Created_At,
+		&p.Updated_At,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db().QueryContext(ctx, filmographyQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	p.Filmography = []*Credit{}
+	for rows.Next() {
+		c := Credit{Name: p.Name}
+		err := rows.Scan(
+			&c.ID,
+			&c.MovieID,
+			&c.MovieTitle,
+			&c.PersonID,
+			&c.Role,
+			&c.Character,
+			&c.BillingOrder,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.Filmography = append(p.Filmography, &c)
+	}
+
+	return &p, rows.Err()
+}
+
+var insertCreditQuery = register("movie_credits.insert", `insert into movie_credits (movie_id, person_id, role, character_name, billing_order, created_at)
+			values ($1, $2, $3, $4, $5, $6)`)
+
+var deleteCreditsQuery = register("movie_credits.delete", `delete from movie_credits where movie_id = $1`)
+
+var personByNameQuery = register("people.by_name", `select id from people where name = $1 order by id limit 1`)
+
+var insertPersonQuery = register("people.insert", `insert into people (name, created_at, updated_at) values ($1, $2, $2) returning id`)
+
+//SetMovieCredits replaces all credits of a movie.A credit without a PersonID is matched to a person by name, and the person is created if nobody has that name yet
+func (m *DBModel) SetMovieCredits(ctx context.Context, movieID int, credits []*Credit) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return m.transaction(ctx, func(tx *DBModel) error {
+		q := tx.db()
+
+		_, err := q.ExecContext(ctx, deleteCreditsQuery, movieID)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range credits {
+			personID := c.PersonID
+			if personID == 0 {
+				err = q.QueryRowContext(ctx, personByNameQuery, c.Name).Scan(&personID)
+				if errors.Is(err, sql.ErrNoRows) {
+					err = q.QueryRowContext(ctx, insertPersonQuery,
+						c.Name, time.Now()).Scan(&personID)
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = q.ExecContext(ctx, insertCreditQuery, movieID, personID, c.Role, c.Character, c.BillingOrder, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+
+		//the cast and crew are part of the movie's responses
+		return touchMovie(ctx, q, movieID)
+	})
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//ErrInvalidSort is returned when a listing is asked to sort by something it can't sort by
+var ErrInvalidSort = errors.New("invalid sort")
+
+//movieSorts are the fields movie listings can be sorted by and their columns
+var movieSorts = map[string]string{
+	"title":        "title",
+	"year":         "year",
+	"release_date": "release_date",
+	"rating":       "rating",
+	"runtime":      "runtime",
+}
+
+//sortField is one field of a sort like "-year,title", desc when it starts with a minus
+type sortField struct {
+	name string
+	desc bool
+}
+
+//parseSort reads a comma separated sort.Every field has to be one of allowed, anything else is ErrInvalidSort
+//so user input never gets into the sql
+func parseSort(sort string, allowed map[string]string) ([]sortField, error) {
+	var fields []sortField
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		f := sortField{name: strings.TrimPrefix(part, "-"), desc: strings.HasPrefix(part, "-")}
+		if _, ok := allowed[f.name]; !ok {
+			return nil, fmt.Errorf("%w: can't sort by %q", ErrInvalidSort, part)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+//selectBuilder puts a select together from fixed sql and values.Conditions use ? for their values, which become
+//numbered placeholders, so values only ever reach the database as arguments.Only sql written in the code and
+//columns from a whitelist end up in the query text
+type selectBuilder struct {
+	columns string
+	from    string
+	conds   []string
+	args    []interface{}
+	order   []string
+	//0 means no limit
+	limit  int
+	offset int
+}
+
+func selectFrom(from, columns string) *selectBuilder {
+	return &selectBuilder{columns: columns, from: from}
+}
+
+//where adds a condition, and-ed with the others.cond must have one ? for every arg
+func (b *selectBuilder) where(cond string, args ...interface{}) *selectBuilder {
+	if strings.Count(cond, "?") != len(args) {
+		panic(fmt.Sprintf("models: %d args for %q", len(args), cond))
+	}
+	b.conds = append(b.conds, cond)
+	b.args = append(b.args, args...)
+	return b
+}
+
+//orderBy sorts by columns written in the code
+func (b *selectBuilder) orderBy(columns ...string) *selectBuilder {
+	b.order = append(b.order, columns...)
+	return b
+}
+
+//sortBy sorts by a sort that came from outside, like "-year,title".The fields are looked up in allowed
+func (b *selectBuilder) sortBy(sort string, allowed map[string]string) error {
+	fields, err := parseSort(sort, allowed)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.desc {
+			b.order = append(b.order, allowed[f.name]+" desc")
+		} else {
+			b.order = append(b.order, allowed[f.name])
+		}
+	}
+	return nil
+}
+
+func (b *selectBuilder) page(limit, offset int) *selectBuilder {
+	b.limit, b.offset = limit, offset
+	return b
+}
+
+//whereSQL is the where clause with the ? numbered from $1, or "" without conditions
+func (b *selectBuilder) whereSQL() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+
+	var sql strings.Builder
+	n := 0
+	for _, r := range " where " + strings.Join(b.conds, " and ") {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&sql, "$%d", n)
+			continue
+		}
+		sql.WriteRune(r)
+	}
+	return sql.String()
+}
+
+//build returns the query and the values for its placeholders
+func (b *selectBuilder) build() (string, []interface{}) {
+	query := "select " + b.columns + " from " + b.from + b.whereSQL()
+	if len(b.order) > 0 {
+		query += " order by " + strings.Join(b.order, ", ")
+	}
+
+	args := append([]interface{}{}, b.args...)
+	if b.limit > 0 {
+		args = append(args, b.limit, b.offset)
+		query += fmt.Sprintf(" limit $%d offset $%d", len(args)-1, len(args))
+	}
+	return query, args
+}
+
+//count returns a query counting the rows the select matches, without its order and page
+func (b *selectBuilder) count() (string, []interface{}) {
+	return "select count(*) from " + b.from + b.whereSQL(), append([]interface{}{}, b.args...)
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSelectBuilder(t *testing.T) {
+	b := selectFrom("movies", "id, title").
+		where("deleted_at is null").
+		where("genre_id = ?", 3).
+		where("lower(title) like lower(?) and year > ?", "%x%", 2000)
+	err := b.sortBy("-year,title", movieSorts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query, args := b.orderBy("id").page(20, 40).build()
+	want := "select id, title from movies where deleted_at is null and genre_id = $1 and lower(title) like lower($2) and year > $3" +
+		" order by year desc, title, id limit $4 offset $5"
+	if query != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{3, "%x%", 2000, 20, 40}) {
+		t.Errorf("unexpected args %v", args)
+	}
+
+	count, args := b.count()
+	if count != "select count(*) from movies where deleted_at is null and genre_id = $1 and lower(title) like lower($2) and year > $3" {
+		t.Errorf("unexpected count query %s", count)
+	}
+	if len(args) != 3 {
+		t.Errorf("the count shouldn't have the page args, got %v", args)
+	}
+}
+
+func TestSelectBuilderRejectsInjection(t *testing.T) {
+	for _, sort := range []string{
+		"title; drop table movies",
+		"title desc",
+		"title,(select password from users)",
+		"id",
+		"-",
+		"",
+		"title,",
+	} {
+		err := selectFrom("movies", "id").sortBy(sort, movieSorts)
+		if !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("sort %q: expected ErrInvalidSort, got %v", sort, err)
+		}
+	}
+
+	//values are always args, never sql
+	evil := "x' or '1'='1'; drop table movies; --"
+	query, args := selectFrom("movies", "id").where("title = ?", evil).build()
+	if query != "select id from movies where title = $1" || args[0] != evil {
+		t.Errorf("the value got into the query: %s %v", query, args)
+	}
+}
+
+func TestSelectBuilderArgCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("a condition without a placeholder for its arg should panic")
+		}
+	}()
+	selectFrom("movies", "id").where("title = 'x'", "x")
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+//Transactor runs fn with Models that share one transaction, see DBModel.WithTx
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(tx Models) error) error
+}
+
+//MovieRepository is everything the api does with movies, their revisions and their images.
+//DBModel is the postgres one and MemoryModel keeps everything in memory for tests
+type MovieRepository interface {
+	Get(ctx context.Context, id int) (*Movie, error)
+	All(ctx context.Context, genre ...int) ([]*Movie, error)
+	ListMovies(ctx context.Context, filter MovieFilter, limit, offset int) ([]*Movie, int, error)
+	EachMovie(ctx context.Context, filter MovieFilter, fn func(movie *Movie, genres []string) error) error
+	InsertMovie(ctx context.Context, movie *Movie) error
+	UpdateMovie(ctx context.Context, movie *Movie) error
+	DeleteMovieDb(ctx context.Context, id int) error
+	DeletedMovies(ctx context.Context) ([]*Movie, error)
+	RestoreMovie(ctx context.Context, id int) error
+	PurgeMovies(ctx context.Context, before time.Time) (int64, error)
+	LastModified(ctx context.Context) (time.Time, error)
+	SetMovieImage(ctx context.Context, movieID int, kind, key string) (string, error)
+	MovieRevisions(ctx context.Context, movieID int) ([]*MovieRevision, error)
+	MovieRevision(ctx context.Context, movieID, revision int) (*MovieRevision, error)
+	ImportMovies(ctx context.Context, rows []ImportRow, dryRun bool) ([]ImportResult, bool, error)
+}
+
+//GenreRepository is for reading genres
+type GenreRepository interface {
+	GenreAll(ctx context.Context) ([]*Genre, error)
+	GenresForMovies(ctx context.Context, movieIDs []int) (map[int][]*Genre, error)
+}
+
+//UserRepository finds the users that can sign in
+type UserRepository interface {
+	GetUser(ctx context.Context, id int) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	SaveUser(ctx context.Context, user *User) error
+}
+
+//ReviewRepository is for user reviews and their moderation
+type ReviewRepository interface {
+	SaveReview(ctx context.Context, review Review) error
+	MovieReviews(ctx context.Context, movieID, page, pageSize int) ([]*Review, int, error)
+	HideReview(ctx context.Context, id int, hidden bool) error
+	DeleteReview(ctx context.Context, id int) error
+}
+
+//ListRepository is for the users' own movie lists
+type ListRepository interface {
+	UserLists(ctx context.Context, userID int) ([]*List, error)
+	GetList(ctx context.Context, id int) (*List, error)
+	ListBySlug(ctx context.Context, slug string) (*List, error)
+	InsertList(ctx context.Context, list List) (int, error)
+	UpdateList(ctx context.Context, list List) error
+	DeleteList(ctx context.Context, id int) error
+	AddListMovie(ctx context.Context, listID, movieID int) error
+	RemoveListMovie(ctx context.Context, listID, movieID int) error
+	ReorderList(ctx context.Context, listID int, movieIDs []int) error
+}
+
+//PersonRepository is for people and the credits linking them to movies
+type PersonRepository interface {
+	GetPerson(ctx context.Context, id int) (*Person, error)
+	SetMovieCredits(ctx context.Context, movieID int, credits []*Credit) error
+}
+
+//both implementations have to keep up with the interfaces
+var (
+	_ Transactor       = (*DBModel)(nil)
+	_ MovieRepository  = (*DBModel)(nil)
+	_ GenreRepository  = (*DBModel)(nil)
+	_ UserRepository   = (*DBModel)(nil)
+	_ ReviewRepository = (*DBModel)(nil)
+	_ ListRepository   = (*DBModel)(nil)
+	_ PersonRepository = (*DBModel)(nil)
+
+	_ Transactor       = (*MemoryModel)(nil)
+	_ MovieRepository  = (*MemoryModel)(nil)
+	_ GenreRepository  = (*MemoryModel)(nil)
+	_ UserRepository   = (*MemoryModel)(nil)
+	_ ReviewRepository = (*MemoryModel)(nil)
+	_ ListRepository   = (*MemoryModel)(nil)
+	_ PersonRepository = (*MemoryModel)(nil)
+)
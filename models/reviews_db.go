@@ -0,0 +1,126 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+var saveReviewQuery = register("reviews.save", `insert into reviews (movie_id, user_id, rating, body, created_at, updated_at) values ($1, $2, $3, $4, $5, $6)
+	on conflict (movie_id, user_id) do update set rating = excluded.rating, body = excluded.body, updated_at = excluded.updated_at`)
+
+//SaveReview adds a user's review of a movie, or edits it if the user already reviewed that movie
+func (m *DBModel) SaveReview(ctx context.Context, review Review) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	//the unique (movie_id, user_id) constraint is what makes this an edit for a second review.Hidden reviews stay hidden after an edit
+	return m.transaction(ctx, func(tx *DBModel) error {
+		_, err := tx.db().ExecContext(ctx, saveReviewQuery,
+			review.MovieID,
+			review.UserID,
+			review.Rating,
+			review.Body,
+			review.Created_At,
+			review.Updated_At,
+		)
+		if err != nil {
+			return err
+		}
+		//the movie's average rating changed
+		return touchMovie(ctx, tx.db(), review.MovieID)
+	})
+}
+
+var movieReviewsQuery = register("reviews.by_movie", `select id, movie_id, user_id, rating, body, hidden, created_at, updated_at from reviews
+	where movie_id = $1 and not hidden order by created_at desc, id desc limit $2 offset $3`)
+
+var countReviewsQuery = register("reviews.count", `select count(*) from reviews where movie_id = $1 and not hidden`)
+
+//MovieReviews returns one page of the visible reviews of a movie, newest first, and the total number of visible reviews
+func (m *DBModel) MovieReviews(ctx context.Context, movieID, page, pageSize int) ([]*Review, int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var total int
+	err := m.db().QueryRowContext(ctx, countReviewsQuery, movieID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := m.db().QueryContext(ctx, movieReviewsQuery, movieID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var r Review
+		err := rows.Scan(
+			&r.ID,
+			&r.MovieID,
+			&r.UserID,
+			&r.Rating,
+			&r.Body,
+			&r.Hidden,
+			&r.Created_At,
+			&r.Updated_At,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		reviews = append(reviews, &r)
+	}
+
+	return reviews, total, rows.Err()
+}
+
+var hideReviewQuery = register("reviews.hide", `update reviews set hidden = $1 where id = $2`)
+
+var touchReviewedMovieQuery = register("movies.touch_reviewed", `update movies set updated_at = $1 where id = (select movie_id from reviews where id = $2)`)
+
+//HideReview hides or unhides a review for moderation
+func (m *DBModel) HideReview(ctx context.Context, id int, hidden bool) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return m.transaction(ctx, func(tx *DBModel) error {
+		return tx.changeReview(ctx, id, hideReviewQuery, hidden, id)
+	})
+}
+
+var deleteReviewQuery = register("reviews.delete", `delete from reviews where id = $1`)
+
+//DeleteReview removes a review for good
+func (m *DBModel) DeleteReview(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return m.transaction(ctx, func(tx *DBModel) error {
+		return tx.changeReview(ctx, id, deleteReviewQuery, id)
+	})
+}
+
+//changeReview runs query on the review with the given id, which changes the rating of its movie.The movie is
+//touched first, a deleted review doesn't know its movie anymore
+func (m *DBModel) changeReview(ctx context.Context, id int, query string, args ...interface{}) error {
+	_, err := m.db().ExecContext(ctx, touchReviewedMovieQuery, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	result, err := m.db().ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
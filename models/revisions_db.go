@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var movieRevisionsQuery = register("movie_revisions.by_movie", `select id, movie_id, revision, title, description, year, release_date, runtime, rating, mpaa_rating, created_at
+	from movie_revisions where movie_id = $1 order by revision`)
+
+//MovieRevisions returns every revision of a movie, oldest first, with the changes from the revision before it filled in
+func (m *DBModel) MovieRevisions(ctx context.Context, movieID int) ([]*MovieRevision, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, movieRevisionsQuery, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*MovieRevision
+
+	for rows.Next() {
+		var r MovieRevision
+		err := rows.Scan(
+			&r.ID,
+			&r.MovieID,
+			&r.Revision,
+			&r.Title,
+			&r.Description,
+			&r.Year,
+			&r.ReleaseDate,
+			&r.Runtime,
+			&r.Rating,
+			&r.MPAARating,
+			&r.Created_At,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		//the first revision has nothing to compare against
+		r.Changes = []FieldChange{}
+		if len(revisions) > 0 {
+			r.Changes = r.Diff(revisions[len(revisions)-1])
+		}
+		revisions = append(revisions, &r)
+	}
+
+	return revisions, rows.Err()
+}
+
+var movieRevisionQuery = register("movie_revisions.get", `select id, movie_id, revision, title, description, year, release_date, runtime, rating, mpaa_rating, created_at
+	from movie_revisions where movie_id = $1 and revision = $2`)
+
+//MovieRevision returns one revision of a movie
+func (m *DBModel) MovieRevision(ctx context.Context, movieID, revision int) (*MovieRevision, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var r MovieRevision
+	err := m.db().QueryRowContext(ctx, movieRevisionQuery, movieID, revision).Scan(
+		&r.ID,
+		&r.MovieID,
+		&r.Revision,
+		&r.Title,
+		&r.Description,
+		&r.Year,
+		&r.ReleaseDate,
+		&r.Runtime,
+		&r.Rating,
+		&r.MPAARating,
+		&r.Created_At,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//registry has every query of the DBModel that is always the same sql, keyed by that sql.
+//They get prepared once when the models are made instead of on every call
+var registry = make(map[string]string)
+
+//register puts query in the registry under name and returns it.name is what the slow query log and the
+//metrics call the query, it is made of the table and what the query does like "movies.get"
+func register(name, query string) string {
+	registry[query] = name
+	return query
+}
+
+//statements are the prepared queries of the registry.They are shared by every DBModel made from the same NewModels
+type statements struct {
+	bySQL map[string]*sql.Stmt
+}
+
+//prepare prepares every registered query on db.It fails on the first query the database doesn't accept,
+//which usually means the schema is behind the code
+func prepare(ctx context.Context, db *sql.DB) (*statements, error) {
+	s := &statements{bySQL: make(map[string]*sql.Stmt, len(registry))}
+	for query, name := range registry {
+		stmt, err := db.PrepareContext(ctx, query)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("prepare %s: %w", name, err)
+		}
+		s.bySQL[query] = stmt
+	}
+	return s, nil
+}
+
+func (s *statements) close() {
+	for _, stmt := range s.bySQL {
+		stmt.Close()
+	}
+}
+
+//queryName is the registered name of query.Queries built on the fly get their table and verb, like "movies.select"
+func queryName(query string) string {
+	if name, ok := registry[query]; ok {
+		return name
+	}
+
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return "unknown"
+	}
+	verb := words[0]
+	for i, word := range words[:len(words)-1] {
+		if word == "from" || word == "into" || (word == "update" && i == 0) {
+			return strings.Trim(words[i+1], "(),") + "." + verb
+		}
+	}
+	return verb
+}
+
+//instrumented runs the queries of a DBModel.Registered queries use their prepared statement, every query is timed and
+//handed to the hook
+type instrumented struct {
+	m *DBModel
+	q querier
+}
+
+//stmt is the prepared statement for query, bound to the transaction if there is one.It is nil for unregistered queries
+func (i instrumented) stmt(ctx context.Context, query string) *sql.Stmt {
+	if i.m.stmts == nil {
+		return nil
+	}
+	stmt, ok := i.m.stmts.bySQL[query]
+	if !ok {
+		return nil
+	}
+	if i.m.tx != nil {
+		return i.m.tx.StmtContext(ctx, stmt)
+	}
+	return stmt
+}
+
+func (i instrumented) observe(ctx context.Context, query string, args []interface{}, start time.Time, err error) {
+	if i.m.Hook == nil {
+		return
+	}
+	i.m.Hook.AfterQuery(ctx, QueryEvent{
+		Name:     queryName(query),
+		Query:    query,
+		Args:     args,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+func (i instrumented) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	var result sql.Result
+	var err error
+	if stmt := i.stmt(ctx, query); stmt != nil {
+		result, err = stmt.ExecContext(ctx, args...)
+	} else {
+		result, err = i.q.ExecContext(ctx, query, args...)
+	}
+	i.observe(ctx, query, args, start, err)
+	return result, err
+}
+
+func (i instrumented) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	var rows *sql.Rows
+	var err error
+	if stmt := i.stmt(ctx, query); stmt != nil {
+		rows, err = stmt.QueryContext(ctx, args...)
+	} else {
+		rows, err = i.q.QueryContext(ctx, query, args...)
+	}
+	i.observe(ctx, query, args, start, err)
+	return rows, err
+}
+
+func (i instrumented) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	var row *sql.Row
+	if stmt := i.stmt(ctx, query); stmt != nil {
+		row = stmt.QueryRowContext(ctx, args...)
+	} else {
+		row = i.q.QueryRowContext(ctx, query, args...)
+	}
+	//no rows only shows up in Scan, Err has the errors of running the query
+	i.observe(ctx, query, args, start, row.Err())
+	return row
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//maxTxAttempts is how many times a transaction is tried when the database keeps giving up on it
+const maxTxAttempts = 3
+
+//errRollback can be returned from a transaction func to roll back without it being an error
+var errRollback = errors.New("rollback")
+
+//savepoints numbers the savepoints so nested transactions never share a name
+var savepoints int64
+
+//db is what the queries of m run on, its transaction if it has one.Every query goes through the prepared
+//statements and the hook
+func (m *DBModel) db() querier {
+	if m.tx != nil {
+		return instrumented{m: m, q: m.tx}
+	}
+	return instrumented{m: m, q: m.DB}
+}
+
+//models returns Models that all run on m
+func (m *DBModel) models() Models {
+	return Models{
+		Transactor: m,
+		Movies:     m,
+		Genres:     m,
+		Users:      m,
+		Reviews:    m,
+		Lists:      m,
+		People:     m,
+	}
+}
+
+//WithTx runs fn with Models that all work in one transaction.It is committed when fn returns nil and
+//rolled back when fn returns an error or panics.When the database aborts it because of a concurrent
+//transaction fn is run again, so fn shouldn't do anything outside the models it can't do twice.
+//Inside another transaction WithTx uses a savepoint, rolling back only what fn did
+func (m *DBModel) WithTx(ctx context.Context, fn func(tx Models) error) error {
+	return m.transaction(ctx, func(tx *DBModel) error {
+		return fn(tx.models())
+	})
+}
+
+//transaction is WithTx for the models themselves.fn gets a DBModel bound to the transaction
+func (m *DBModel) transaction(ctx context.Context, fn func(tx *DBModel) error) error {
+	for attempt := 1; ; attempt++ {
+		err := m.runTx(ctx, fn)
+		if errors.Is(err, errRollback) {
+			return nil
+		}
+		//a savepoint can't be retried on its own, the outer transaction has to start over
+		if err == nil || m.tx != nil || attempt == maxTxAttempts || !m.Dialect.retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 20 * time.Millisecond):
+		}
+	}
+}
+
+func (m *DBModel) runTx(ctx context.Context, fn func(tx *DBModel) error) (err error) {
+	tx := *m
+	var savepoint string
+
+	if m.tx == nil {
+		tx.tx, err = m.DB.BeginTx(ctx, m.Dialect.txOptions())
+		if err != nil {
+			return err
+		}
+	} else {
+		savepoint = fmt.Sprintf("models_%d", atomic.AddInt64(&savepoints, 1))
+		_, err = m.tx.ExecContext(ctx, "savepoint "+savepoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	rollback := func() {
+		if savepoint == "" {
+			tx.tx.Rollback()
+		} else {
+			m.tx.Exec("rollback to savepoint " + savepoint)
+			m.tx.Exec("release savepoint " + savepoint)
+		}
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(&tx)
+	if err != nil {
+		rollback()
+		return err
+	}
+
+	if savepoint == "" {
+		return tx.tx.Commit()
+	}
+	_, err = m.tx.ExecContext(ctx, "release savepoint "+savepoint)
+	return err
+}
+
+//txOptions are the options transactions are started with.Postgres transactions are serializable so
+//concurrent ones can't see each other half way, the failures that gives are retried.Sqlite is always serializable
+func (d Dialect) txOptions() *sql.TxOptions {
+	if d == SQLite {
+		return nil
+	}
+	return &sql.TxOptions{Isolation: sql.LevelSerializable}
+}
+
+//retryable reports if err means the transaction lost to a concurrent one and can be run again
+func (d Dialect) retryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		//serialization_failure and deadlock_detected
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) {
+		//extended codes keep the primary code in the low byte
+		return liteErr.Code()&0xff == sqlite3.SQLITE_BUSY
+	}
+
+	return false
+}
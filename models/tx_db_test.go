@@ -0,0 +1,67 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+//TestTransactionRetries checks that a transaction losing to a concurrent one is run again, and only the outermost
+func TestTransactionRetries(t *testing.T) {
+	db, err := OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m := &DBModel{DB: db, Dialect: SQLite}
+
+	ctx := context.Background()
+	serialization := &pq.Error{Code: "40001"}
+
+	calls := 0
+	err = m.transaction(ctx, func(tx *DBModel) error {
+		calls++
+		if calls == 1 {
+			return serialization
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("expected a second attempt to go through, got %d calls and %v", calls, err)
+	}
+
+	calls = 0
+	err = m.transaction(ctx, func(tx *DBModel) error {
+		calls++
+		//deadlock_detected
+		return &pq.Error{Code: "40P01"}
+	})
+	if calls != maxTxAttempts || !m.Dialect.retryable(err) {
+		t.Errorf("expected %d attempts and the last error, got %d calls and %v", maxTxAttempts, calls, err)
+	}
+
+	calls = 0
+	errFailed := errors.New("failed")
+	err = m.transaction(ctx, func(tx *DBModel) error {
+		calls++
+		return errFailed
+	})
+	if calls != 1 || !errors.Is(err, errFailed) {
+		t.Errorf("other errors aren't retried, got %d calls and %v", calls, err)
+	}
+
+	//a savepoint gives up straight away, the outer transaction starts over and runs it again
+	outer, inner := 0, 0
+	err = m.transaction(ctx, func(tx *DBModel) error {
+		outer++
+		return tx.transaction(ctx, func(tx *DBModel) error {
+			inner++
+			return serialization
+		})
+	})
+	if outer != maxTxAttempts || inner != maxTxAttempts || !errors.Is(err, serialization) {
+		t.Errorf("expected one savepoint attempt per transaction attempt, got %d outer, %d inner and %v", outer, inner, err)
+	}
+}
@@ -0,0 +1,106 @@
+package models_test
+
+import (
+	"backend/migrations"
+	"backend/models"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//backends returns Models for every implementation, each on an empty database
+func backends(t *testing.T) map[string]models.Models {
+	db, err := models.OpenSQLite(filepath.Join(t.TempDir(), "movies.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = models.Migrate(context.Background(), db, models.SQLite, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := models.NewModels(context.Background(), db, models.Config{Dialect: models.SQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]models.Models{
+		"memory": models.NewMemoryModels(models.NewMemoryModel()),
+		"sqlite": m,
+	}
+}
+
+func insert(ctx context.Context, t *testing.T, m models.Models, title string) {
+	now := time.Now()
+	err := m.Movies.InsertMovie(ctx, &models.Movie{Title: title, ReleaseDate: models.NewDate(now), Created_At: now, Updated_At: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func titles(ctx context.Context, t *testing.T, m models.Models) []string {
+	movies, _, err := m.Movies.ListMovies(ctx, models.MovieFilter{}, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var titles []string
+	for _, movie := range movies {
+		titles = append(titles, movie.Title)
+	}
+	return titles
+}
+
+func TestWithTx(t *testing.T) {
+	ctx := context.Background()
+	errFailed := errors.New("failed")
+
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			err := m.WithTx(ctx, func(tx models.Models) error {
+				insert(ctx, t, tx, "Rolled back")
+				return errFailed
+			})
+			if !errors.Is(err, errFailed) {
+				t.Errorf("expected the error from fn, got %v", err)
+			}
+
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Error("the panic should reach the caller")
+					}
+				}()
+				m.WithTx(ctx, func(tx models.Models) error {
+					insert(ctx, t, tx, "Panicked")
+					panic("boom")
+				})
+			}()
+
+			//a failed nested transaction only rolls back its own work
+			err = m.WithTx(ctx, func(tx models.Models) error {
+				insert(ctx, t, tx, "Outer")
+				nested := tx.WithTx(ctx, func(tx models.Models) error {
+					insert(ctx, t, tx, "Inner")
+					return errFailed
+				})
+				if !errors.Is(nested, errFailed) {
+					t.Errorf("expected the error from the nested fn, got %v", nested)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := titles(ctx, t, m)
+			if len(got) != 1 || got[0] != "Outer" {
+				t.Errorf("expected only Outer to be saved, got %q", got)
+			}
+		})
+	}
+}
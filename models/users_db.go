@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const userColumns = `id, email, password, is_admin`
+
+func scanUser(row *sql.Row) (*User, error) {
+	var u User
+	err := row.Scan(&u.ID, &u.Email, &u.Password, &u.Admin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+var getUserQuery = register("users.get", `select `+userColumns+` from users where id = $1`)
+
+//GetUser returns one user by id
+func (m *DBModel) GetUser(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(m.db().QueryRowContext(ctx, getUserQuery, id))
+}
+
+var userByEmailQuery = register("users.by_email", `select `+userColumns+` from users where lower(email) = lower($1)`)
+
+//GetUserByEmail returns the user signing in with that email.Emails are matched without caring about case
+func (m *DBModel) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return scanUser(m.db().QueryRowContext(ctx, userByEmailQuery, email))
+}
+
+var insertUserQuery = register("users.insert", `insert into users (email, password, is_admin, created_at, updated_at)
+	values ($1, $2, $3, $4, $4) returning id`)
+
+var updateUserQuery = register("users.update", `update users set password = $1, is_admin = $2, updated_at = $3 where id = $4`)
+
+//SaveUser adds the user, or when there already is one with that email sets its password and admin flag.
+//Password has to be a bcrypt hash already.user.ID is set to the id of the saved user
+func (m *DBModel) SaveUser(ctx context.Context, user *User) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return m.transaction(ctx, func(tx *DBModel) error {
+		now := time.Now()
+		stored, err := tx.GetUserByEmail(ctx, user.Email)
+		if errors.Is(err, ErrNotFound) {
+			return tx.db().QueryRowContext(ctx, insertUserQuery, user.Email, user.Password, user.Admin, now).Scan(&user.ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		user.ID = stored.ID
+		_, err = tx.db().ExecContext(ctx, updateUserQuery, user.Password, user.Admin, now, stored.ID)
+		return err
+	})
+}
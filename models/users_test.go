@@ -0,0 +1,49 @@
+package models_test
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSaveUser(t *testing.T) {
+	ctx := context.Background()
+
+	for name, m := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			//the migrations don't add anyone, the old hard coded account included
+			_, err := m.Users.GetUserByEmail(ctx, "me@gmail.com")
+			if !errors.Is(err, models.ErrNotFound) {
+				t.Fatalf("expected no users, got %v", err)
+			}
+
+			user := models.User{Email: "admin@example.com", Password: "hash"}
+			err = m.Users.SaveUser(ctx, &user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ID == 0 {
+				t.Fatal("expected the new id")
+			}
+
+			//the same email again changes the user that is there
+			again := models.User{Email: "Admin@example.com", Password: "new hash", Admin: true}
+			err = m.Users.SaveUser(ctx, &again)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.ID != user.ID {
+				t.Errorf("expected user %d to be updated, got %d", user.ID, again.ID)
+			}
+
+			saved, err := m.Users.GetUser(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.Email != "admin@example.com" || saved.Password != "new hash" || !saved.Admin {
+				t.Errorf("unexpected user %+v", saved)
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+//Package moviepb is the generated code for proto/movie.proto.Run go generate after changing the proto file
+package moviepb
+
+//go:generate protoc -I .. --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative movie.proto
@@ -0,0 +1,24 @@
+//Package storage keeps uploaded files like movie posters.
+//BlobStore hides where they actually live so the handlers don't care if it's a local folder or an S3 bucket
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+//ErrNotFound is returned by Get when there is nothing stored under the key
+var ErrNotFound = errors.New("blob not found")
+
+//BlobStore stores blobs under slash separated keys like "posters/12/ab34/original.jpg"
+type BlobStore interface {
+	//Put stores everything read from r under key, replacing what was there
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	//Get returns the blob stored under key. The caller has to close it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	//Delete removes the blob under key. Deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	//URL returns where clients can download the blob from
+	URL(key string) string
+}
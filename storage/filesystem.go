@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//FileStore keeps blobs as files in a local directory.It is also an http.Handler so the API can serve the files itself
+type FileStore struct {
+	dir     string
+	baseURL string
+	files   http.Handler
+}
+
+//NewFileStore makes a FileStore in dir, creating it if needed.baseURL is where ServeHTTP is mounted, like http://localhost:8080/v1/images
+func NewFileStore(dir, baseURL string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		files:   http.FileServer(http.Dir(dir)),
+	}, nil
+}
+
+//path turns a key into a file path inside the store directory.Keys with .. in them can't get out of it
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	p := s.path(key)
+
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+
+	//we write to a temporary file first so nobody can download half a file
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+//ServeHTTP serves the stored files.It expects the mount prefix to be stripped already
+func (s *FileStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	//no directory listings
+	if strings.HasSuffix(r.URL.Path, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	s.files.ServeHTTP(w, r)
+}